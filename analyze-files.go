@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	logcache "code.cloudfoundry.org/log-cache/pkg/client"
+	"code.cloudfoundry.org/log-cache/pkg/rpc/logcache_v1"
+	"github.com/blang/semver"
+)
+
+var (
+	querySelector       = regexp.MustCompile(`([A-Za-z_:][A-Za-z0-9_:]*)?\{([^}]*)\}`)
+	queryMatcher        = regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_]*)\s*!?=~?\s*"([^"]*)"`)
+	queryFunction       = regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_]*)\s*\(\s*([0-9.]+\s*,)?`)
+	queryBy             = regexp.MustCompile(`\bby\s*\(([^)]*)\)`)
+	queryFileUnsafe     = regexp.MustCompile("[^A-Za-z0-9-]+")
+	errOfflineNoVersion = fmt.Errorf("log-cache version is not available offline")
+	analyzeFilesUsage   = `
+
+cf firehose-analyzer analyze-files <options> <directory>
+
+Builds the report from "cf query" outputs saved in directory instead of talking to
+log-cache.  Every query is read from the file named next to it in the README, made
+of the source id, job, metric, functions and grouping of the query, for example
+doppler_ingress_sum_rate.json.  Outputs saved under other names are read when
+directory holds a manifest.json mapping each file name to its query.  --list prints
+the cf query commands that create the files and does not need a foundation.
+Trends and noisiest apps are not available offline.
+
+Options
+--profile <name> - required, legacy, syslog-agent or forwarder-agent
+--list         - print the cf query commands for every query the report needs
+-d, -o, -l, -s, -n, -k, -r, --catalog, --group-by, --jobs, --format
+               - same as the live analyzer.  -d, -o, -l, --catalog and --group-by
+                 change the queries so use the same values with --list`
+)
+
+// queryManifest optional file of a dump directory mapping file names to queries
+const queryManifest = "manifest.json"
+
+// queryFileName file holding the cf query output of q.  The name is built from the
+// source id, job and other label values, the metric, the functions from the outside in
+// and the grouping labels so the same query reads the same file however it is spaced.
+// Durations and offsets are left out
+func queryFileName(q string) string {
+	parts := make([]string, 0)
+	var metric, rest string
+	if m := querySelector.FindStringSubmatchIndex(q); m != nil {
+		if m[2] >= 0 {
+			metric = q[m[2]:m[3]]
+		}
+		labels := make(map[string]string)
+		keys := make([]string, 0)
+		for _, l := range queryMatcher.FindAllStringSubmatch(q[m[4]:m[5]], -1) {
+			if l[1] == "__name__" {
+				metric = l[2]
+				continue
+			}
+			labels[l[1]] = l[2]
+			if l[1] != "source_id" && l[1] != "job" {
+				keys = append(keys, l[1])
+			}
+		}
+		sort.Strings(keys)
+		parts = append(parts, labels["source_id"])
+		if job := labels["job"]; job != "" && job != labels["source_id"] {
+			parts = append(parts, job)
+		}
+		parts = append(parts, metric)
+		for _, k := range keys {
+			parts = append(parts, labels[k])
+		}
+		rest = q[:m[0]] + q[m[1]:]
+	}
+	by := queryBy.FindStringSubmatch(rest)
+	rest = queryBy.ReplaceAllString(rest, "")
+	for _, f := range queryFunction.FindAllStringSubmatch(rest, -1) {
+		parts = append(parts, f[1])
+		if f[2] != "" {
+			// quantile_over_time(0.99, ...)
+			parts = append(parts, strings.TrimSpace(strings.TrimSuffix(f[2], ",")))
+		}
+	}
+	if by != nil {
+		parts = append(parts, "by")
+		parts = append(parts, strings.Split(by[1], ",")...)
+	}
+	name := strings.Trim(queryFileUnsafe.ReplaceAllString(strings.Join(parts, "_"), "_"), "_")
+	if name == "" {
+		// bare metric names
+		name = strings.Trim(queryFileUnsafe.ReplaceAllString(q, "_"), "_")
+	}
+	return strings.ToLower(name) + ".json"
+}
+
+// fileClient answers promql queries from cf query outputs saved in dir
+type fileClient struct {
+	dir      string
+	once     sync.Once
+	manifest map[string]string // queryFileName of a query to the file holding it
+	err      error
+}
+
+// file name of the output holding query, from the manifest when dir has one
+func (f *fileClient) file(query string) (string, error) {
+	f.once.Do(func() {
+		b, err := ioutil.ReadFile(filepath.Join(f.dir, queryManifest))
+		if os.IsNotExist(err) {
+			return
+		}
+		if err != nil {
+			f.err = err
+			return
+		}
+		var files map[string]string
+		if err := json.Unmarshal(b, &files); err != nil {
+			f.err = fmt.Errorf("could not parse %s: %s", queryManifest, err)
+			return
+		}
+		f.manifest = make(map[string]string)
+		for file, q := range files {
+			f.manifest[queryFileName(q)] = file
+		}
+	})
+	if f.err != nil {
+		return "", f.err
+	}
+	name := queryFileName(query)
+	if file, ok := f.manifest[name]; ok {
+		return file, nil
+	}
+	return name, nil
+}
+
+// sample converts a cf query vector item to a promql sample
+func (i CacheResultItem) sample() (*logcache_v1.PromQL_Sample, error) {
+	if len(i.Value) != 2 {
+		return nil, fmt.Errorf("expected [timestamp, value] got %v", i.Value)
+	}
+	s, ok := i.Value[1].(string)
+	if !ok {
+		return nil, fmt.Errorf("expected string value got %v", i.Value[1])
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &logcache_v1.PromQL_Sample{
+		Metric: i.Metric,
+		Point:  &logcache_v1.PromQL_Point{Time: fmt.Sprintf("%v", i.Value[0]), Value: v},
+	}, nil
+}
+
+// PromQL reads the cf query output saved for query
+func (f *fileClient) PromQL(ctx context.Context, query string, opts ...logcache.PromQLOption) (*logcache_v1.PromQL_InstantQueryResult, error) {
+	name, err := f.file(query)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(filepath.Join(f.dir, name))
+	if err != nil {
+		return nil, fmt.Errorf("no query output %s", name)
+	}
+	var r CacheResult
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %s", name, err)
+	}
+	if r.Status != "success" {
+		return nil, fmt.Errorf("%s holds a failed query, status \"%s\"", name, r.Status)
+	}
+	if r.Data.ResultType != "vector" {
+		return nil, fmt.Errorf("%s holds a %s result, expected vector", name, r.Data.ResultType)
+	}
+	vector := &logcache_v1.PromQL_Vector{}
+	for _, item := range r.Data.Result {
+		s, err := item.sample()
+		if err != nil {
+			return nil, fmt.Errorf("could not parse %s: %s", name, err)
+		}
+		vector.Samples = append(vector.Samples, s)
+	}
+	return &logcache_v1.PromQL_InstantQueryResult{
+		Result: &logcache_v1.PromQL_InstantQueryResult_Vector{Vector: vector},
+	}, nil
+}
+
+// PromQLRange range queries depend on when they run so they are not read from files
+func (f *fileClient) PromQLRange(ctx context.Context, query string, opts ...logcache.PromQLOption) (*logcache_v1.PromQL_RangeQueryResult, error) {
+	return nil, fmt.Errorf("range queries are not available offline")
+}
+
+// Meta source ids are not part of cf query outputs
+func (f *fileClient) Meta(ctx context.Context) (map[string]*logcache_v1.MetaInfo, error) {
+	return map[string]*logcache_v1.MetaInfo{}, nil
+}
+
+// LogCacheVersion the version is not part of cf query outputs
+func (f *fileClient) LogCacheVersion(ctx context.Context) (semver.Version, error) {
+	return semver.Version{}, errOfflineNoVersion
+}
+
+// NewLogCacheFileClient creates a new LCC that reads cf query outputs from dir
+func NewLogCacheFileClient(dir string, concurrency int, cycleTimeout time.Duration) *LCC {
+	return &LCC{Concurrency: concurrency, CycleTimeout: cycleTimeout, client: &fileClient{dir: dir}, offline: true}
+}
+
+// printQueryCommands prints a cf query command for every instant query of a cycle
+func printQueryCommands(s *Snapshot, dir string) {
+	seen := make(map[string]bool)
+	for _, q := range s.Queries {
+		if q.Range || seen[q.Query] {
+			continue
+		}
+		seen[q.Query] = true
+		fmt.Printf("cf query '%s' > %s\n", q.Query, filepath.Join(dir, queryFileName(q.Query)))
+	}
+}
+
+func startAnalyzeFiles(args []string) {
+	reporting = true
+	fs := flag.NewFlagSet("firehose-analyze-files-args", flag.ContinueOnError)
+	addAnalyzerFlags(fs)
+	list := fs.Bool("list", false, "Specify to print the cf query commands")
+	fs.Usage = func() { fmt.Println(analyzeFilesUsage) }
+	parseFlags(fs, args)
+	if fs.NArg() != 1 {
+		fmt.Println(analyzeFilesUsage)
+		os.Exit(setupExitCode())
+	}
+	if err := validateAnalyzerFlags(); err != nil {
+		fmt.Println(err)
+		os.Exit(setupExitCode())
+	}
+	logger.SetOutput(statusOutput())
+	if *profile == autoProfile {
+		fmt.Printf("analyze-files can not detect the platform, use --profile %s\n", strings.Join(profileNames(), ", "))
+		os.Exit(setupExitCode())
+	}
+	// range queries are not saved by cf query
+	*trendWindow = 0
+
+	catalog, err := LoadCatalog(*catalogFile)
+	if err != nil {
+		fatalln(err)
+	}
+	lcc := NewLogCacheFileClient(fs.Arg(0), *concurrency, *cycleTimeout)
+	lcc.Catalog = catalog
+	if err := lcc.SelectProfile(*profile); err != nil {
+		fatalln(err)
+	}
+	if *list {
+		lcc.Collect()
+		printQueryCommands(lcc.Snapshot(), fs.Arg(0))
+		return
+	}
+	os.Exit(runOnce(lcc))
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueryFileName(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		file  string
+	}{
+		{name: "rate", query: `sum(rate(ingress{source_id="doppler"}[5m] offset 2m))`, file: "doppler_ingress_sum_rate.json"},
+		{name: "spacing ignored", query: `sum( rate( ingress{ source_id = "doppler" }[1m] ) )`, file: "doppler_ingress_sum_rate.json"},
+		{name: "job", query: `sum(doppler_proxy_firehoses{source_id="traffic_controller",job="loggregator_trafficcontroller"} offset 2m)`, file: "traffic_controller_loggregator_trafficcontroller_doppler_proxy_firehoses_sum.json"},
+		{name: "other labels", query: `sum(max_over_time(dropped{source_id="doppler",direction="ingress"}[5m] offset 2m)) by (index)`, file: "doppler_dropped_ingress_sum_max_over_time_by_index.json"},
+		{name: "name matcher", query: `min({__name__="cache-period",source_id="log-cache"} offset 2m) by (index)`, file: "log-cache_cache-period_min_by_index.json"},
+		{name: "quantile", query: `max(quantile_over_time(0.99, latency{source_id="traffic_controller"}[5m]))`, file: "traffic_controller_latency_max_quantile_over_time_0_99.json"},
+		{name: "grouping", query: `sum(rate(dropped{source_id="metron"}[5m])) by (deployment, job, index) > 0`, file: "metron_dropped_sum_rate_by_deployment_job_index.json"},
+		{name: "bare metric", query: "egress", file: "egress.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := queryFileName(tt.query); got != tt.file {
+				t.Errorf("queryFileName(%q) = %s, expected %s", tt.query, got, tt.file)
+			}
+		})
+	}
+}
+
+// TestReadmeQueryFileNames every query in the README names the file it is read from
+func TestReadmeQueryFileNames(t *testing.T) {
+	b, err := ioutil.ReadFile("README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(b), "\n")
+	queries := 0
+	for i, l := range lines {
+		if !strings.HasPrefix(l, "`'") {
+			continue
+		}
+		queries++
+		q := strings.TrimSuffix(strings.TrimPrefix(l, "`'"), "'`")
+		want := "saved as `" + queryFileName(q) + "`"
+		if i+1 == len(lines) || lines[i+1] != want {
+			t.Errorf("README.md:%d expected %q under %s", i+1, want, q)
+		}
+	}
+	if queries == 0 {
+		t.Error("expected the README to list queries")
+	}
+}
+
+func TestCacheResultItemSample(t *testing.T) {
+	tests := []struct {
+		name    string
+		item    CacheResultItem
+		wantErr bool
+		value   float64
+	}{
+		{
+			name:  "valid",
+			item:  CacheResultItem{Metric: map[string]string{"index": "0", "placement_tag": "iso"}, Value: []interface{}{1580000000.5, "12.5"}},
+			value: 12.5,
+		},
+		{name: "missing timestamp", item: CacheResultItem{Value: []interface{}{"12.5"}}, wantErr: true},
+		{name: "numeric value", item: CacheResultItem{Value: []interface{}{1580000000.5, 12.5}}, wantErr: true},
+		{name: "not a number", item: CacheResultItem{Value: []interface{}{1580000000.5, "twelve"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := tt.item.sample()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("sample() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if s.Point.Value != tt.value {
+				t.Errorf("sample() value = %v, expected %v", s.Point.Value, tt.value)
+			}
+			if s.Point.Time != "1.5800000005e+09" {
+				t.Errorf("sample() time = %s", s.Point.Time)
+			}
+			for k, v := range tt.item.Metric {
+				if s.Metric[k] != v {
+					t.Errorf("sample() label %s = %s, expected %s", k, s.Metric[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestFileClientPromQL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "analyze-files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	outputs := map[string]string{
+		"failed": `{"status":"error","data":{}}`,
+		"matrix": `{"status":"success","data":{"resultType":"matrix","result":[]}}`,
+		"broken": `{"status":"success"`,
+		"bad":    `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1580000000,"x"]}]}}`,
+		"vector": `{"status":"success","data":{"resultType":"vector","result":[` +
+			`{"metric":{"index":"0","placement_tag":"iso"},"value":[1580000000,"3"]},` +
+			`{"metric":{"index":"1"},"value":[1580000000,"4"]}]}}`,
+	}
+	for q, body := range outputs {
+		if err := ioutil.WriteFile(filepath.Join(dir, queryFileName(q)), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query   string
+		wantErr string
+		samples int
+	}{
+		{query: "missing", wantErr: "no query output"},
+		{query: "failed", wantErr: "holds a failed query"},
+		{query: "matrix", wantErr: "holds a matrix result"},
+		{query: "broken", wantErr: "could not parse"},
+		{query: "bad", wantErr: "could not parse"},
+		{query: "vector", samples: 2},
+	}
+	f := &fileClient{dir: dir}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			r, err := f.PromQL(context.Background(), tt.query)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("PromQL(%s) error = %v, expected %q", tt.query, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PromQL(%s) error = %v", tt.query, err)
+			}
+			samples := r.GetVector().GetSamples()
+			if len(samples) != tt.samples {
+				t.Fatalf("PromQL(%s) returned %d samples, expected %d", tt.query, len(samples), tt.samples)
+			}
+			if samples[0].Metric["placement_tag"] != "iso" {
+				t.Errorf("PromQL(%s) dropped label placement_tag: %v", tt.query, samples[0].Metric)
+			}
+		})
+	}
+}
+
+func TestFileClientManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "analyze-files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	query := `sum(rate(ingress{source_id="doppler"}[5m] offset 2m))`
+	files := map[string]string{
+		queryManifest:  `{"ingress.json": "sum(rate(ingress{source_id=\"doppler\"}[5m] offset 2m))"}`,
+		"ingress.json": `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1580000000,"7"]}]}}`,
+	}
+	for name, body := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f := &fileClient{dir: dir}
+	r, err := f.PromQL(context.Background(), query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if samples := r.GetVector().GetSamples(); len(samples) != 1 || samples[0].Point.Value != 7 {
+		t.Errorf("expected the manifest file to be read got %v", samples)
+	}
+	// queries missing from the manifest keep their own names
+	if _, err := f.PromQL(context.Background(), `sum(rate(egress{source_id="doppler"}[5m]))`); err == nil || !strings.Contains(err.Error(), "doppler_egress_sum_rate.json") {
+		t.Errorf("expected doppler_egress_sum_rate.json to be missing got %v", err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, queryManifest), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&fileClient{dir: dir}).PromQL(context.Background(), query); err == nil || !strings.Contains(err.Error(), queryManifest) {
+		t.Errorf("expected a broken manifest to be reported got %v", err)
+	}
+}
+
+// TestAnalyzeReadmeNamedFiles outputs saved under the names listed in the README build the report
+func TestAnalyzeReadmeNamedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "analyze-files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	vector := func(v string) string {
+		return `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1580000000,"` + v + `"]}]}}`
+	}
+	files := map[string]string{
+		"doppler_ingress_sum_rate.json":  vector("1500"),
+		"doppler_subscriptions_sum.json": vector("4"),
+	}
+	for name, body := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	window := *trendWindow
+	*trendWindow = 0
+	defer func() { *trendWindow = window }()
+
+	catalog, err := LoadCatalog("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lcc := NewLogCacheFileClient(dir, 4, 10*time.Second)
+	lcc.Catalog = catalog
+	if err := lcc.SelectProfile("syslog-agent"); err != nil {
+		t.Fatal(err)
+	}
+	lcc.Collect()
+	d := lcc.Snapshot().Metric.Doppler
+	if d.Ingress != 1500 || d.Subscriptions != 4 {
+		t.Errorf("expected ingress 1500 and 4 subscriptions got %v and %v", d.Ingress, d.Subscriptions)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"code.cloudfoundry.org/log-cache/pkg/rpc/logcache_v1"
+)
+
+// AppRate envelope rate of a single application
+type AppRate struct {
+	GUID  string  `json:"guid"`
+	Name  string  `json:"name"`  // org/space/app
+	Rate  float64 `json:"rate"`  // envelopes/s
+	Share float64 `json:"share"` // fraction of total agent ingress
+}
+
+// metaSample log-cache meta captured at a point in time
+type metaSample struct {
+	taken time.Time
+	meta  map[string]*logcache_v1.MetaInfo
+}
+
+// collectMeta schedules a meta read which is stored in dst
+func (lc *LCC) collectMeta(p *queryPool, dst *metaSample) {
+	p.Go("meta", func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+		defer cancel()
+		meta, err := lc.client.Meta(ctx)
+		if err != nil {
+			return fmt.Errorf("meta: %s", err)
+		}
+		p.Do(func() { *dst = metaSample{taken: time.Now(), meta: meta} })
+		return nil
+	})
+}
+
+// appRates computes envelopes per second for every app source id seen in both samples.
+// Envelopes written is the change in count plus the change in expired envelopes
+func appRates(prev, cur metaSample) []AppRate {
+	elapsed := cur.taken.Sub(prev.taken).Seconds()
+	rates := make([]AppRate, 0)
+	if prev.meta == nil || cur.meta == nil || elapsed <= 0 {
+		return rates
+	}
+	for id, c := range cur.meta {
+		if !isAppGUID(id) {
+			continue
+		}
+		p, ok := prev.meta[id]
+		if !ok {
+			continue
+		}
+		written := (c.GetCount() - p.GetCount()) + (c.GetExpired() - p.GetExpired())
+		if written <= 0 {
+			continue
+		}
+		rates = append(rates, AppRate{GUID: id, Rate: float64(written) / elapsed})
+	}
+	sort.SliceStable(rates, func(i, j int) bool {
+		if rates[i].Rate == rates[j].Rate {
+			return rates[i].GUID < rates[j].GUID
+		}
+		return rates[i].Rate > rates[j].Rate
+	})
+	return rates
+}
+
+// topApps keeps the n noisiest apps, resolves their names and computes their share of
+// the agent ingress rate
+func (lc *LCC) topApps(rates []AppRate, n int, agentIngress float64) ([]AppRate, error) {
+	if len(rates) == 0 {
+		return rates, nil
+	}
+	if n < len(rates) {
+		rates = rates[:n]
+	}
+	guids := make([]string, 0, len(rates))
+	for i := range rates {
+		guids = append(guids, rates[i].GUID)
+	}
+	err := lc.resolver().Resolve(guids)
+	for i := range rates {
+		rates[i].Name = rates[i].GUID
+		if a, ok := lc.apps.Lookup(rates[i].GUID); ok {
+			rates[i].Name = a.String()
+		}
+		if agentIngress > 0 {
+			rates[i].Share = rates[i].Rate / agentIngress
+		}
+	}
+	return rates, err
+}
+
+// resolver returns the app resolver, seeding it with the apps in the targeted space
+func (lc *LCC) resolver() *appResolver {
+	if lc.apps != nil {
+		return lc.apps
+	}
+	lc.apps = newAppResolver()
+	apps, err := cfCLI.GetApps()
+	if err != nil {
+		return lc.apps
+	}
+	org, _ := cfCLI.GetCurrentOrg()
+	space, _ := cfCLI.GetCurrentSpace()
+	for _, a := range apps {
+		lc.apps.apps[a.Guid] = AppInfo{GUID: a.Guid, Name: a.Name, Space: space.Name, Org: org.Name}
+	}
+	return lc.apps
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAppStats(t *testing.T) {
+	apps := []AppRate{{GUID: "6f3e", Name: "org/space/app", Rate: 150, Share: 0.75}}
+	tests := []struct {
+		name     string
+		n        int
+		snapshot Snapshot
+		want     string
+	}{
+		{name: "apps", n: 10, snapshot: Snapshot{Metric: Metrics{Apps: apps}}, want: "org/space/app"},
+		{name: "first collection", n: 10, snapshot: Snapshot{}, want: "available after the next collection"},
+		{name: "no meta", n: 10, snapshot: Snapshot{NoAppRates: true}, want: "app rates are unavailable"},
+		{name: "disabled", n: 0, snapshot: Snapshot{Metric: Metrics{Apps: apps}}, want: ""},
+	}
+	defer func(n int) { *topApps = n }(*topApps)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*topApps = tt.n
+			got := appStats(&tt.snapshot)
+			if tt.want == "" && got != "" {
+				t.Errorf("expected no panel got %q", got)
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("expected %q in %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestOfflineNoAppRates(t *testing.T) {
+	catalog, err := LoadCatalog("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	window := *trendWindow
+	*trendWindow = 0
+	defer func() { *trendWindow = window }()
+
+	lcc := NewLogCacheFileClient(t.TempDir(), 4, 10e9)
+	lcc.Catalog = catalog
+	if err := lcc.SelectProfile("syslog-agent"); err != nil {
+		t.Fatal(err)
+	}
+	lcc.Collect()
+	if !lcc.Snapshot().NoAppRates {
+		t.Error("expected offline snapshots to have no app rates")
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// appGUIDPattern source ids of app envelopes are the app guid
+var appGUIDPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// appLookupBatch max number of guids resolved with a single cf curl
+const appLookupBatch = 50
+
+// AppInfo org, space and name of an app
+type AppInfo struct {
+	GUID  string
+	Name  string
+	Space string
+	Org   string
+}
+
+// String org/space/app
+func (a AppInfo) String() string {
+	return fmt.Sprintf("%s/%s/%s", a.Org, a.Space, a.Name)
+}
+
+// appResolver resolves app guids to names through the cf cli connection and caches the results
+type appResolver struct {
+	apps map[string]AppInfo
+}
+
+func newAppResolver() *appResolver {
+	return &appResolver{apps: make(map[string]AppInfo)}
+}
+
+// isAppGUID true when the source id looks like an app guid
+func isAppGUID(sourceID string) bool {
+	return appGUIDPattern.MatchString(sourceID)
+}
+
+// Lookup returns the cached app for guid
+func (r *appResolver) Lookup(guid string) (AppInfo, bool) {
+	a, ok := r.apps[guid]
+	return a, ok
+}
+
+// Resolve looks up every guid that is not already cached using the v3 apps api
+func (r *appResolver) Resolve(guids []string) error {
+	missing := make([]string, 0)
+	for _, g := range guids {
+		if _, ok := r.apps[g]; !ok && isAppGUID(g) {
+			missing = append(missing, g)
+		}
+	}
+	for i := 0; i < len(missing); i += appLookupBatch {
+		end := i + appLookupBatch
+		if end > len(missing) {
+			end = len(missing)
+		}
+		if err := r.resolveBatch(missing[i:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type v3Relationship struct {
+	Data struct {
+		GUID string `json:"guid"`
+	} `json:"data"`
+}
+
+type v3AppsResponse struct {
+	Resources []struct {
+		GUID          string `json:"guid"`
+		Name          string `json:"name"`
+		Relationships struct {
+			Space v3Relationship `json:"space"`
+		} `json:"relationships"`
+	} `json:"resources"`
+	Included struct {
+		Spaces []struct {
+			GUID          string `json:"guid"`
+			Name          string `json:"name"`
+			Relationships struct {
+				Organization v3Relationship `json:"organization"`
+			} `json:"relationships"`
+		} `json:"spaces"`
+		Organizations []struct {
+			GUID string `json:"guid"`
+			Name string `json:"name"`
+		} `json:"organizations"`
+	} `json:"included"`
+}
+
+func (r *appResolver) resolveBatch(guids []string) error {
+	path := fmt.Sprintf("/v3/apps?guids=%s&per_page=%d&include=space.organization", strings.Join(guids, ","), appLookupBatch)
+	out, err := cfCLI.CliCommandWithoutTerminalOutput("curl", path)
+	if err != nil {
+		return fmt.Errorf("cf curl %s: %s", path, err)
+	}
+
+	var resp v3AppsResponse
+	if err := json.Unmarshal([]byte(strings.Join(out, "\n")), &resp); err != nil {
+		return fmt.Errorf("could not parse cf curl %s: %s", path, err)
+	}
+
+	orgs := make(map[string]string)
+	for _, o := range resp.Included.Organizations {
+		orgs[o.GUID] = o.Name
+	}
+	spaces := make(map[string][2]string) // space guid -> space name, org name
+	for _, s := range resp.Included.Spaces {
+		spaces[s.GUID] = [2]string{s.Name, orgs[s.Relationships.Organization.Data.GUID]}
+	}
+	for _, a := range resp.Resources {
+		space := spaces[a.Relationships.Space.Data.GUID]
+		r.apps[a.GUID] = AppInfo{GUID: a.GUID, Name: a.Name, Space: space[0], Org: space[1]}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// openArchive opens the record file for appending.  Every snapshot is written as its
+// own gzip member holding one json document so an interrupted recording stays readable
+func openArchive(path string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open archive: %s", err)
+	}
+	ofh = f
+	arvhiveEnabled = true
+	return nil
+}
+
+// recordSnapshot appends s to the archive
+func recordSnapshot(s *Snapshot) error {
+	gz := gzip.NewWriter(ofh)
+	if err := writeSnapshotJSON(gz, s, false); err != nil {
+		gz.Close()
+		return err
+	}
+	return gz.Close()
+}
+
+// collectAndRecord runs a collection cycle and appends the snapshot to the archive
+// when recording is enabled
+func collectAndRecord(lcc *LCC) {
+	lcc.Collect()
+	if !arvhiveEnabled {
+		return
+	}
+	if err := recordSnapshot(lcc.Snapshot()); err != nil {
+		logger.Printf("Could not record snapshot: %s\n", err)
+	}
+}
+
+// readArchive reads every snapshot recorded in path
+func readArchive(path string) ([]*Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a snapshot archive: %s", path, err)
+	}
+	defer gz.Close()
+
+	snaps := make([]*Snapshot, 0)
+	dec := json.NewDecoder(gz)
+	for {
+		var doc SnapshotDocument
+		err := dec.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// keep what was read from a recording that was cut off
+			if len(snaps) > 0 && (err == io.ErrUnexpectedEOF || err == gzip.ErrChecksum) {
+				break
+			}
+			return nil, fmt.Errorf("could not read snapshot %d: %s", len(snaps)+1, err)
+		}
+		if doc.SchemaVersion > snapshotSchemaVersion {
+			return nil, fmt.Errorf("snapshot %d uses schema version %d, this version reads up to %d", len(snaps)+1, doc.SchemaVersion, snapshotSchemaVersion)
+		}
+		snaps = append(snaps, snapshotFromDocument(doc))
+	}
+	if len(snaps) == 0 {
+		return nil, fmt.Errorf("no snapshots recorded in %s", path)
+	}
+	return snaps, nil
+}
+
+// snapshotFromDocument rebuilds the snapshot a document was created from
+func snapshotFromDocument(doc SnapshotDocument) *Snapshot {
+	s := &Snapshot{
+		Metric:        doc.Metrics,
+		Start:         doc.Start,
+		Stop:          doc.Stop,
+		Offset:        doc.Offset,
+		Duration:      doc.Duration,
+		Profile:       doc.Profile,
+		ProfileReason: doc.ProfileReason,
+		Queries:       doc.Queries,
+	}
+	for _, e := range doc.Errors {
+		s.CollectionErrors = append(s.CollectionErrors, errors.New(e))
+	}
+	return s
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestArchiveRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshots.gz")
+	if err := openArchive(path); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ofh.Close()
+		ofh, arvhiveEnabled = nil, false
+	}()
+
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name     string
+		snapshot *Snapshot
+	}{
+		{"doppler count", &Snapshot{Start: start, Stop: start.Add(time.Second), Profile: "syslog-agent",
+			Metric: Metrics{Doppler: DopplerMetrics{Ingress: 1000, MessageRateCapacity: 500, System: InstanceMetrics{Count: 2}}}}},
+		{"zero doppler count", &Snapshot{Start: start.Add(time.Minute), Stop: start.Add(time.Minute + time.Second), Profile: "syslog-agent",
+			Metric:           Metrics{Doppler: DopplerMetrics{Ingress: 1000, MessageRateCapacity: math.Inf(1)}},
+			CollectionErrors: []error{errors.New("count query failed")}}},
+		{"no data", &Snapshot{Start: start.Add(2 * time.Minute), Stop: start.Add(2 * time.Minute), Profile: "legacy",
+			Metric: Metrics{Doppler: DopplerMetrics{MessageRateCapacity: math.NaN()}}}},
+	}
+	for _, tt := range tests {
+		if err := recordSnapshot(tt.snapshot); err != nil {
+			t.Fatalf("%s: recordSnapshot: %s", tt.name, err)
+		}
+	}
+
+	snaps, err := readArchive(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snaps) != len(tests) {
+		t.Fatalf("expected %d snapshots got %d", len(tests), len(snaps))
+	}
+	for i, tt := range tests {
+		got := snaps[i]
+		if !got.Start.Equal(tt.snapshot.Start) || got.Profile != tt.snapshot.Profile {
+			t.Errorf("%s: got start %s profile %s", tt.name, got.Start, got.Profile)
+		}
+		if got.Metric.Doppler.Ingress != tt.snapshot.Metric.Doppler.Ingress {
+			t.Errorf("%s: expected ingress %v got %v", tt.name, tt.snapshot.Metric.Doppler.Ingress, got.Metric.Doppler.Ingress)
+		}
+		if len(got.CollectionErrors) != len(tt.snapshot.CollectionErrors) {
+			t.Errorf("%s: expected %d errors got %d", tt.name, len(tt.snapshot.CollectionErrors), len(got.CollectionErrors))
+		}
+	}
+	if c := snaps[1].Metric.Doppler.MessageRateCapacity; c != 0 {
+		t.Errorf("expected infinite capacity to be recorded as 0 got %v", c)
+	}
+}
+
+func TestReadArchiveTruncated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshots.gz")
+	if err := openArchive(path); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ofh, arvhiveEnabled = nil, false
+	}()
+	for i := 0; i < 2; i++ {
+		if err := recordSnapshot(&Snapshot{Start: time.Now(), Stop: time.Now(), Profile: "syslog-agent"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	info, err := ofh.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ofh.Close()
+	// cut the second member in half as an interrupted recording would
+	if err := os.Truncate(path, info.Size()-20); err != nil {
+		t.Fatal(err)
+	}
+	snaps, err := readArchive(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snaps) != 1 {
+		t.Errorf("expected the complete snapshot to be read got %d", len(snaps))
+	}
+}
@@ -6,10 +6,12 @@ import (
 	"fmt"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	logcache "code.cloudfoundry.org/log-cache/pkg/client"
 	"code.cloudfoundry.org/log-cache/pkg/rpc/logcache_v1"
+	"github.com/blang/semver"
 	jwt "github.com/dgrijalva/jwt-go"
 )
 
@@ -58,6 +60,7 @@ https://prometheus.io/docs/prometheus/latest/querying/basics/#range-vector-selec
 // CacheMetric used to parse result reponse
 type CacheMetric struct {
 	Addr         string `json:"addr"`
+	AZ           string `json:"az"`
 	Deployment   string `json:"deployment"`
 	Host         string `json:"host"`
 	ID           string `json:"id"`
@@ -72,8 +75,8 @@ type CacheMetric struct {
 
 // CacheResultItem used to parse reulst reponse
 type CacheResultItem struct {
-	Metric CacheMetric   `json:"metric"`
-	Value  []interface{} `json:"value"` // [ timestamp int, value string ]
+	Metric map[string]string `json:"metric"` // every label, CacheMetric lists the common ones
+	Value  []interface{}     `json:"value"`  // [ timestamp int, value string ]
 }
 
 // CacheData used to parse result reponse
@@ -102,79 +105,120 @@ func (c *tokenHTTPClient) Do(req *http.Request) (*http.Response, error) {
 	if len(c.accessToken) > 0 {
 		req.Header.Set("Authorization", c.accessToken)
 	}
-	return c.c.Do(req)
+	resp, err := c.c.Do(req)
+	return resp, certificateHint(err)
 }
 
 // InstanceMetrics average system metrics for instance groups
 type InstanceMetrics struct {
-	CPUUser float64
-	CPUSys  float64
-	CPUWait float64
-	Memory  float64
-	Count   int64  // number of instances
-	Name    string // name
+	CPUUser        float64 `json:"cpu_user"`
+	CPUSys         float64 `json:"cpu_sys"`
+	CPUWait        float64 `json:"cpu_wait"`
+	Memory         float64 `json:"memory"`
+	Count          int64   `json:"count"`           // number of instances
+	Name           string  `json:"name"`            // name
+	DiskSystem     float64 `json:"disk_system"`     // max percent across instances
+	DiskEphemeral  float64 `json:"disk_ephemeral"`  // max percent across instances
+	DiskPersistent float64 `json:"disk_persistent"` // max percent across instances
+	Load1m         float64 `json:"load_1m"`         // average
+	Swap           float64 `json:"swap"`            // max percent across instances
+	NetBytesIn     float64 `json:"net_bytes_in"`    // bytes/s across instances
+	NetBytesOut    float64 `json:"net_bytes_out"`   // bytes/s across instances
+	NetErrors      float64 `json:"net_errors"`      // errors/s across instances
+	CPUUserSpread  Spread  `json:"cpu_user_spread"` // cpu user across instances
+	MemorySpread   Spread  `json:"memory_spread"`   // memory across instances
+
+	cpuSamples    []instanceSample
+	memorySamples []instanceSample
+}
+
+// LatencyQuantiles latency quantiles over the sample window
+type LatencyQuantiles struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
 }
 
 // TrafficControllerMetrics TC metrics
 type TrafficControllerMetrics struct {
-	System           InstanceMetrics
-	SlowConsumers    float64
-	AppStreams       float64
-	Egress           float64
-	Ingress          float64
-	ContainerLatency float64
+	System           InstanceMetrics  `json:"system"`
+	SlowConsumers    float64          `json:"slow_consumers"`
+	AppStreams       float64          `json:"app_streams"`
+	Firehoses        float64          `json:"firehoses"`
+	Egress           float64          `json:"egress"`
+	Ingress          float64          `json:"ingress"`
+	ContainerLatency LatencyQuantiles `json:"container_latency"` // milliseconds
 }
 
 type RLPMetrics struct {
-	Egress  float64
-	Ingress float64
-	Dropped float64
+	Egress  float64 `json:"egress"`
+	Ingress float64 `json:"ingress"`
+	Dropped float64 `json:"dropped"`
 }
 
 // MetronMetrics metron metrics
 type MetronMetrics struct {
-	System      InstanceMetrics
-	Ingress     float64
-	Egress      float64
-	Dropped     float64
-	AVGEnvelope float64
-	Name        string // name/index
+	System      InstanceMetrics `json:"system"`
+	Ingress     float64         `json:"ingress"`
+	Egress      float64         `json:"egress"`
+	Dropped     float64         `json:"dropped"`
+	AVGEnvelope float64         `json:"avg_envelope"`
+	Name        string          `json:"name"` // name/index
+	Deployment  string          `json:"deployment"`
+	Job         string          `json:"job"`
+	Index       string          `json:"index"`
 }
 
 // DopplerMetrics doppler metrics
 type DopplerMetrics struct {
-	System              InstanceMetrics
-	MessageRateCapacity float64
-	Subscriptions       float64
-	Egress              float64
-	Ingress             float64
-	IngressDropped      float64
-	Dropped             float64
-	Name                string // name/index
+	System              InstanceMetrics `json:"system"`
+	MessageRateCapacity float64         `json:"message_rate_capacity"`
+	Subscriptions       float64         `json:"subscriptions"`
+	Egress              float64         `json:"egress"`
+	Ingress             float64         `json:"ingress"`
+	IngressDropped      float64         `json:"ingress_dropped"`
+	Dropped             float64         `json:"dropped"`
+	DumpSinks           float64         `json:"dump_sinks"`
+	SinksDropped        float64         `json:"sinks_dropped"`
+	SinkErrorsDropped   float64         `json:"sink_errors_dropped"`
+	Name                string          `json:"name"` // name/index
+}
+
+// IngressLoss fraction of ingress dropped by the doppler itself
+func (d DopplerMetrics) IngressLoss() float64 {
+	return d.Dropped / d.Ingress
+}
+
+// SinkLoss fraction of ingress dropped by sinks, counted separately from ingress loss
+func (d DopplerMetrics) SinkLoss() float64 {
+	return (d.SinksDropped + d.SinkErrorsDropped) / d.Ingress
 }
 
 // SyslogAdapterMetrics syslog adapter metrics
 type SyslogAdapterMetrics struct {
-	System  InstanceMetrics
-	Ingress float64
-	Dropped float64
+	System   InstanceMetrics `json:"system"`
+	Bindings float64         `json:"bindings"`
+	Ingress  float64         `json:"ingress"`
+	Egress   float64         `json:"egress"`
+	Dropped  float64         `json:"dropped"`
 }
 
 // SyslogSchedulerMetrics syslog scheduler metrics
 type SyslogSchedulerMetrics struct {
-	System InstanceMetrics
+	System InstanceMetrics `json:"system"`
+	Drains float64         `json:"drains"`
 }
 
 // DrainMetrics Drain metrics
 type DrainMetrics struct {
-	AgentBindings          float64
-	AgentIngress           float64
-	AgentEgress            float64
-	AgentDropped           float64
-	AgentInvalidDrains     float64
-	AgentActiveDrains      float64
-	AgentNonAppDrains      float64
-	AgentBlacklistedDrains float64
+	AgentBindings          float64 `json:"agent_bindings"`
+	AgentIngress           float64 `json:"agent_ingress"`
+	AgentEgress            float64 `json:"agent_egress"`
+	AgentDropped           float64 `json:"agent_dropped"`
+	AgentInvalidDrains     float64 `json:"agent_invalid_drains"`
+	AgentActiveDrains      float64 `json:"agent_active_drains"`
+	AgentNonAppDrains      float64 `json:"agent_non_app_drains"`
+	AgentBlacklistedDrains float64 `json:"agent_blacklisted_drains"`
 }
 
 /*
@@ -187,48 +231,103 @@ GAUGE invalid_drains:0.000000
 
 // Metrics root of all computed metrics
 type Metrics struct {
-	System          []InstanceMetrics
-	Doppler         DopplerMetrics
-	TC              TrafficControllerMetrics
-	RLP             RLPMetrics
-	Metron          MetronMetrics
-	Drain           DrainMetrics
-	DopplerInstance DopplerMetrics
-	MetronInstance  MetronMetrics
-	SyslogAdapter   SyslogAdapterMetrics
-	SyslogScheduler SyslogSchedulerMetrics
+	System          []InstanceMetrics        `json:"system"`
+	Doppler         DopplerMetrics           `json:"doppler"`
+	TC              TrafficControllerMetrics `json:"traffic_controller"`
+	RLP             RLPMetrics               `json:"rlp"`
+	Metron          MetronMetrics            `json:"metron"`
+	Drain           DrainMetrics             `json:"drain"`
+	DopplerInstance []DopplerMetrics         `json:"doppler_instances"`
+	DopplerSkew     DopplerSkew              `json:"doppler_skew"`
+	MetronInstance  []MetronMetrics          `json:"metron_instances"`
+	SyslogAdapter   SyslogAdapterMetrics     `json:"syslog_adapter"`
+	SyslogScheduler SyslogSchedulerMetrics   `json:"syslog_scheduler"`
+	LogCache        []LogCacheMetrics        `json:"log_cache"`
+	Apps            []AppRate                `json:"apps"`   // noisiest applications
+	Custom          []CustomMetric           `json:"custom"` // catalog entries not bound to a field
+	GroupBy         string                   `json:"group_by"`
+	Groups          []GroupMetrics           `json:"groups"` // grouped panels when GroupBy is set
+	Trends          Trends                   `json:"trends"`
 }
 
-// LCC used to manage log cache endoint and credentials
-type LCC struct {
-	accessToken      string
-	client           *logcache.Client
+// Snapshot immutable result of a single collection cycle
+type Snapshot struct {
 	Metric           Metrics
-	mux              sync.Mutex
-	Start            time.Time
-	Stop             time.Time
+	Start            time.Time // collection start
+	Stop             time.Time // collection end
 	Offset           string
 	Duration         string
+	Profile          string
+	ProfileReason    string
 	CollectionErrors []error
+	Queries          []ExecutedQuery // queries run by the cycle
+	NoAppRates       bool            // no log-cache meta to sample app rates from
+}
+
+// Age time since the snapshot finished collecting
+func (s *Snapshot) Age() time.Duration {
+	return time.Since(s.Stop)
 }
 
+// Elapsed time it took to collect the snapshot
+func (s *Snapshot) Elapsed() time.Duration {
+	return s.Stop.Sub(s.Start)
+}
+
+// LCC used to manage log cache endoint and credentials
+type LCC struct {
+	accessToken   string
+	client        logCacheReader
+	mux           sync.Mutex   // serializes collection cycles
+	snapshot      atomic.Value // *Snapshot last complete collection
+	collecting    int32
+	Concurrency   int           // max number of queries in flight
+	CycleTimeout  time.Duration // deadline for a full collection cycle
+	Profile       QueryProfile
+	Catalog       Catalog
+	ProfileReason string       // how the profile was chosen
+	apps          *appResolver // app guid to name cache
+	lastMeta      metaSample   // meta from the previous cycle used for app rates
+	queries       queryLog     // queries run by the current cycle
+	offline       bool         // answers queries from files so no token is needed
+	mutualTLS     bool         // authenticates with a client certificate so no token is needed
+}
+
+// logCacheReader log-cache calls used by the analyzer
+type logCacheReader interface {
+	PromQL(ctx context.Context, query string, opts ...logcache.PromQLOption) (*logcache_v1.PromQL_InstantQueryResult, error)
+	PromQLRange(ctx context.Context, query string, opts ...logcache.PromQLOption) (*logcache_v1.PromQL_RangeQueryResult, error)
+	Meta(ctx context.Context) (map[string]*logcache_v1.MetaInfo, error)
+	LogCacheVersion(ctx context.Context) (semver.Version, error)
+}
+
+// queryTimeout deadline for a single log-cache query
+const queryTimeout = 10 * time.Second
+
 var (
-	queryAvgRateJob         string
-	queryAvgRate            string
-	querySumRateJob         string
-	querySumRate            string
-	querySumJob             string
-	querySum                string
-	queryMetricJob          string
-	queryIngressMaxOverTime string
-	queryMin                string
+	queryAvgOverTimeJob      string
+	querySumRateJob          string
+	querySumRate             string
+	querySumRateJobBy        string
+	querySumJobBy            string
+	queryIngressDroppedBy    string
+	queryAgentRateBy         string
+	queryNameSumBy           string
+	queryNameMinBy           string
+	queryNameRateBy          string
+	querySystemCountBy       string
+	querySystemAvgOverTimeBy string
+	querySystemAvgBy         string
+	querySystemMaxBy         string
+	querySystemSumRateBy     string
+	querySystemInstanceAvgBy string
 )
 
 // NewLogCacheClient createa new LCC and returns it
-func NewLogCacheClient(address string) (LCC, error) {
-	lc := LCC{Metric: Metrics{}, CollectionErrors: make([]error, 0)}
+func NewLogCacheClient(address string, tlsConfig *tls.Config, concurrency int, cycleTimeout time.Duration) (*LCC, error) {
+	lc := &LCC{Concurrency: concurrency, CycleTimeout: cycleTimeout}
 	lc.fetchToken()
-	h := http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	h := http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
 	tc := tokenHTTPClient{HTTPClient(&h), lc.accessToken}
 	lc.client = logcache.NewClient(address, logcache.WithHTTPClient(&tc))
 	return lc, nil
@@ -238,11 +337,14 @@ func (lc *LCC) fetchToken() {
 	var err error
 	lc.accessToken, err = cfCLI.AccessToken()
 	if err != nil {
-		logger.Fatalln(err)
+		fatalln(err)
 	}
 }
 
 func (lc *LCC) checkToken() {
+	if lc.offline || lc.mutualTLS {
+		return
+	}
 	t, err := jwt.Parse(lc.accessToken[7:len(lc.accessToken)], func(token *jwt.Token) (interface{}, error) { return []byte(""), nil })
 	if err != nil {
 		if err.Error() != jwt.ErrInvalidKeyType.Error() {
@@ -257,126 +359,157 @@ func (lc *LCC) checkToken() {
 	}
 }
 
-// GetResult given metric and source id result is returned
-func (lc *LCC) GetResult(metric, sourceid, job, q string) (*logcache_v1.PromQL_InstantQueryResult, error) {
-	lc.checkToken()
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	var result *logcache_v1.PromQL_InstantQueryResult
-	var err error
+// formatQuery fills the metric, source id and job when set into the query template q
+func formatQuery(metric, sourceid, job, q string) string {
 	if job != "" {
-		result, err = lc.client.PromQL(ctx, fmt.Sprintf(q, metric, sourceid, job))
-	} else {
-		result, err = lc.client.PromQL(ctx, fmt.Sprintf(q, metric, sourceid))
+		return fmt.Sprintf(q, metric, sourceid, job)
 	}
+	return fmt.Sprintf(q, metric, sourceid)
+}
 
-	return result, err
+// GetResult given metric and source id result is returned
+func (lc *LCC) GetResult(ctx context.Context, metric, sourceid, job, q string) (*logcache_v1.PromQL_InstantQueryResult, error) {
+	return lc.GetQueryResult(ctx, formatQuery(metric, sourceid, job, q))
 }
 
-// GetSinlgeMetric given range, metric and source id result is returned
-func (lc *LCC) GetSinlgeMetric(metric, sourceid, job, q string) float64 {
-	lc.checkToken()
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// GetQueryResult runs a fully formatted query
+func (lc *LCC) GetQueryResult(ctx context.Context, q string) (*logcache_v1.PromQL_InstantQueryResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
-	var result *logcache_v1.PromQL_InstantQueryResult
-	var err error
-	var qformatted string
-	if job != "" {
-		qformatted = fmt.Sprintf(q, metric, sourceid, job)
-	} else {
-		qformatted = fmt.Sprintf(q, metric, sourceid)
-	}
-	result, err = lc.client.PromQL(ctx, qformatted)
-
+	start := time.Now()
+	result, err := lc.client.PromQL(ctx, q)
+	lc.queries.record(q, false, start, err)
 	if err != nil {
-		lc.CollectionErrors = append(lc.CollectionErrors, fmt.Errorf("%s: %s", qformatted, err))
+		return result, fmt.Errorf("%s: %s", q, err)
 	}
-
-	return getSingleSampleResult(result.GetVector().GetSamples())
+	return result, nil
 }
 
-// Collect updates metrics from log-cache
+// Collect builds a new snapshot from log-cache and swaps it in once complete
 func (lc *LCC) Collect() error {
-	lc.Lock()
-	defer lc.Unlock()
+	lc.mux.Lock()
+	defer lc.mux.Unlock()
+	atomic.StoreInt32(&lc.collecting, 1)
+	defer atomic.StoreInt32(&lc.collecting, 0)
+
+	snap := &Snapshot{Start: time.Now(), Offset: *sampleOffset, Duration: *sampleDuration, Profile: lc.Profile.Name, ProfileReason: lc.ProfileReason, NoAppRates: lc.offline}
+	m := &snap.Metric
 
-	lc.updateQeries(*sampleOffset, *sampleDuration)
+	lc.checkToken()
+	lc.queries.reset()
+	updateQeries(snap.Offset, snap.Duration, *instanceLabel)
 
-	lc.getAvgSystemMetrics(&lc.Metric.TC.System, tcJob)
-	lc.getAvgSystemMetrics(&lc.Metric.Doppler.System, dopplerJob)
+	ctx, cancel := context.WithTimeout(context.Background(), lc.CycleTimeout)
+	defer cancel()
+	p := newQueryPool(ctx, lc.Concurrency)
 
-	lc.Metric.TC.AppStreams = lc.GetSinlgeMetric(appStreamsGauge, trafficControllerSID, tcJob, querySumJob)
-	lc.Metric.TC.SlowConsumers = lc.GetSinlgeMetric(slowConsumerCounter, trafficControllerSID, tcJob, queryAvgRateJob)
+	lc.collectCatalog(p, lc.Catalog, m, snap.Offset, snap.Duration)
+	groups := make(map[string]*GroupMetrics)
+	if *groupBy != "" {
+		m.GroupBy = *groupBy
+		lc.collectGroups(p, lc.Catalog, *groupBy, snap.Offset, snap.Duration, groups)
+	}
 
-	lc.Metric.Drain.AgentIngress = lc.GetSinlgeMetric(ingressCounter, syslogAgentSID, "", querySumRate)
-	lc.Metric.Drain.AgentEgress = lc.GetSinlgeMetric(egressCounter, syslogAgentSID, "", querySumRate)
-	lc.Metric.Drain.AgentDropped = lc.GetSinlgeMetric(droppedCounter, syslogAgentSID, "", querySumRate)
-	lc.Metric.Drain.AgentBindings = lc.GetSinlgeMetric(drainsGauge, syslogAgentSID, "", queryMin)
-	lc.Metric.Drain.AgentActiveDrains = lc.GetSinlgeMetric(drainsActiveGauge, syslogAgentSID, "", queryMin)
-	lc.Metric.Drain.AgentInvalidDrains = lc.GetSinlgeMetric(drainsInvlaidGauge, syslogAgentSID, "", queryMin)
-	lc.Metric.Drain.AgentBlacklistedDrains = lc.GetSinlgeMetric(drainsBlacklistedGauge, syslogAgentSID, "", queryMin)
-	lc.Metric.Drain.AgentNonAppDrains = lc.GetSinlgeMetric(drainsNonAppGauge, syslogAgentSID, "", queryMin)
+	systemJobs := make(map[string]*InstanceMetrics)
+	lc.collectSystemJobs(p, systemJobs)
+	lc.collectSystemInstances(p, systemJobs)
 
-	lc.Metric.Doppler.Ingress = lc.GetSinlgeMetric(ingressCounter, dopplerSID, dopplerJob, querySumRateJob)
-	lc.Metric.Doppler.IngressDropped = lc.GetSinlgeMetric(droppedCounter, dopplerSID, "", queryIngressMaxOverTime)
-	lc.Metric.Doppler.Egress = lc.GetSinlgeMetric(egressCounter, dopplerSID, dopplerJob, querySumRateJob)
-	lc.Metric.Doppler.Dropped = lc.GetSinlgeMetric(droppedCounter, dopplerSID, dopplerJob, querySumRateJob)
-	lc.Metric.Doppler.Subscriptions = lc.GetSinlgeMetric(subscriptionsGauge, dopplerSID, dopplerJob, querySumJob)
+	dopplers := make(map[string]*DopplerMetrics)
+	lc.collectDopplerInstances(p, *instanceLabel, dopplers)
 
-	lc.Metric.Metron.Ingress = lc.GetSinlgeMetric(ingressCounter, metronSID, "", querySumRate)
-	lc.Metric.Metron.Egress = lc.GetSinlgeMetric(egressCounter, metronSID, "", querySumRate)
-	lc.Metric.Metron.Dropped = lc.GetSinlgeMetric(droppedCounter, metronSID, "", querySumRate)
+	metrons := make(map[string]*MetronMetrics)
+	lc.collectMetronInstances(p, lc.Profile.AgentSID, metrons)
 
-	lc.Metric.RLP.Ingress = lc.GetSinlgeMetric(ingressCounter, rlpSID, tcJob, querySumRateJob)
-	lc.Metric.RLP.Egress = lc.GetSinlgeMetric(egressCounter, rlpSID, tcJob, querySumRateJob)
-	lc.Metric.RLP.Dropped = lc.GetSinlgeMetric(droppedCounter, rlpSID, tcJob, querySumRateJob)
+	logCacheNodes := make(map[string]*LogCacheMetrics)
+	lc.collectLogCacheNodes(p, *instanceLabel, logCacheNodes)
 
-	lc.Metric.Doppler.MessageRateCapacity = float64(lc.Metric.Doppler.Ingress) / float64(lc.Metric.Doppler.System.Count)
+	var meta metaSample
+	if *topApps > 0 && !lc.offline {
+		lc.collectMeta(p, &meta)
+	}
+
+	if *trendWindow > 0 {
+		lc.collectTrends(p, &m.Trends, *trendWindow)
+	}
+
+	p.Wait()
+	snap.CollectionErrors = p.Errors()
+	snap.Queries = lc.queries.reset()
+	m.System = systemJobList(systemJobs, parseJobFilter(*jobFilter))
+	m.DopplerInstance = dopplerInstanceList(dopplers, "name")
+	m.DopplerSkew = dopplerSkew(m.DopplerInstance)
+	m.MetronInstance = metronInstanceList(metrons)
+	m.LogCache = logCacheNodeList(logCacheNodes)
+	sortCustomMetrics(m.Custom)
+	m.Groups = groupList(groups)
+	if meta.meta != nil {
+		apps, err := lc.topApps(appRates(lc.lastMeta, meta), *topApps, m.Metron.Ingress)
+		if err != nil {
+			snap.CollectionErrors = append(snap.CollectionErrors, err)
+		}
+		m.Apps = apps
+		lc.lastMeta = meta
+	}
+
+	if m.Doppler.System.Count > 0 {
+		m.Doppler.MessageRateCapacity = m.Doppler.Ingress / float64(m.Doppler.System.Count)
+	}
+	snap.Stop = time.Now()
+	lc.snapshot.Store(snap)
 	return nil
 }
 
-func (lc *LCC) updateQeries(offset, duration string) {
-	lc.Offset = offset
-	lc.Duration = duration
-	queryAvgRateJob = "avg(rate(%s{source_id=\"%s\",job=\"%s\"}[" + lc.Duration + "] offset " + lc.Offset + "))"
-	queryAvgRate = "avg(rate(%s{source_id=\"%s\"}[" + lc.Duration + "] offset " + lc.Offset + "))"
-	querySumRateJob = "sum(rate(%s{source_id=\"%s\",job=\"%s\"}[" + lc.Duration + "] offset " + lc.Offset + "))"
-	querySumRate = "sum(rate(%s{source_id=\"%s\"}[" + lc.Duration + "] offset " + lc.Offset + "))"
-	querySumJob = "sum(%s{source_id=\"%s\",job=\"%s\"} offset " + lc.Offset + ")"
-	querySum = "sum(%s{source_id=\"%s\"} offset " + lc.Offset + ")"
-	queryMin = "min(%s{source_id=\"%s\"} offset " + lc.Offset + ")"
-	queryMetricJob = "%s{source_id=\"%s\",job=\"%s\"}"
-	queryIngressMaxOverTime = "sum(max_over_time(%s{source_id=\"%s\", direction=\"ingress\"}[" + lc.Duration + "])) by (index) > 0"
+func updateQeries(offset, duration, label string) {
+	queryAvgOverTimeJob = "avg(avg_over_time(%s{source_id=\"%s\",job=\"%s\"}[" + duration + "] offset " + offset + "))"
+	querySumRateJob = "sum(rate(%s{source_id=\"%s\",job=\"%s\"}[" + duration + "] offset " + offset + "))"
+	querySumRate = "sum(rate(%s{source_id=\"%s\"}[" + duration + "] offset " + offset + "))"
+	querySumRateJobBy = "sum(rate(%s{source_id=\"%s\",job=\"%s\"}[" + duration + "] offset " + offset + ")) by (" + label + ")"
+	querySumJobBy = "sum(%s{source_id=\"%s\",job=\"%s\"} offset " + offset + ") by (" + label + ")"
+	queryAgentRateBy = "sum(rate(%s{source_id=\"%s\"}[" + duration + "] offset " + offset + ")) by (" + metronInstanceLabels + ")"
+	querySystemCountBy = "count(%s{source_id=\"%s\"} offset " + offset + ") by (job)"
+	querySystemAvgOverTimeBy = "avg(avg_over_time(%s{source_id=\"%s\"}[" + duration + "] offset " + offset + ")) by (job)"
+	querySystemInstanceAvgBy = "avg(avg_over_time(%s{source_id=\"%s\"}[" + duration + "] offset " + offset + ")) by (job,index,ip)"
+	querySystemAvgBy = "avg(%s{source_id=\"%s\"} offset " + offset + ") by (job)"
+	querySystemMaxBy = "max(%s{source_id=\"%s\"} offset " + offset + ") by (job)"
+	querySystemSumRateBy = "sum(rate(%s{source_id=\"%s\"}[" + duration + "] offset " + offset + ")) by (job)"
+	// log cache metric names contain dashes which are not valid promql identifiers
+	queryNameSumBy = "sum({__name__=\"%s\",source_id=\"%s\"} offset " + offset + ") by (" + label + ")"
+	queryNameMinBy = "min({__name__=\"%s\",source_id=\"%s\"} offset " + offset + ") by (" + label + ")"
+	queryNameRateBy = "sum(rate({__name__=\"%s\",source_id=\"%s\"}[" + duration + "] offset " + offset + ")) by (" + label + ")"
+	queryIngressDroppedBy = "sum(rate(%s{source_id=\"%s\",job=\"%s\",direction=\"ingress\"}[" + duration + "] offset " + offset + ")) by (" + label + ")"
 }
 
 // metric helpers
-func (lc *LCC) setInstanceCount(system *InstanceMetrics, job string) {
-	result, err := lc.GetResult(cpuUserGauge, boshSystemMetricsSID, job, queryMetricJob)
-	if err != nil {
-		lc.CollectionErrors = append(lc.CollectionErrors, err)
-	}
-	sample := result.GetVector().GetSamples()
-	system.Count = int64(len(sample))
+// grouped runs a "by (label)" query and passes the label value and sample value of
+// every series to set while holding the pool lock
+func (lc *LCC) grouped(p *queryPool, label, metric, sourceid, job, q string, set func(name string, v float64)) {
+	lc.groupedBy(p, metric, sourceid, job, q, func(labels map[string]string, v float64) { set(labels[label], v) })
 }
 
-func (lc *LCC) getAvgSystemMetrics(system *InstanceMetrics, job string) {
-	system.CPUUser = lc.GetSinlgeMetric(cpuUserGauge, boshSystemMetricsSID, job, queryAvgRateJob)
-	system.CPUWait = lc.GetSinlgeMetric(cpuWaitGauge, boshSystemMetricsSID, job, queryAvgRateJob)
-	system.CPUSys = lc.GetSinlgeMetric(cpuSYSGauge, boshSystemMetricsSID, job, queryAvgRateJob)
-	system.Memory = lc.GetSinlgeMetric(memoryPercentGauge, boshSystemMetricsSID, job, queryAvgRateJob)
-
-	lc.setInstanceCount(system, job)
+// groupedBy runs a query returning several series and passes the labels and sample
+// value of every series to set while holding the pool lock
+func (lc *LCC) groupedBy(p *queryPool, metric, sourceid, job, q string, set func(labels map[string]string, v float64)) {
+	p.Go(formatQuery(metric, sourceid, job, q), func(ctx context.Context) error {
+		result, err := lc.GetResult(ctx, metric, sourceid, job, q)
+		samples := result.GetVector().GetSamples()
+		p.Do(func() {
+			for _, s := range samples {
+				set(s.GetMetric(), s.GetPoint().GetValue())
+			}
+		})
+		return err
+	})
 }
 
-// Lock used to lock when updating/reading metrics
-func (lc *LCC) Lock() {
-	lc.mux.Lock()
+// Snapshot returns the last complete collection or nil if none has finished yet
+func (lc *LCC) Snapshot() *Snapshot {
+	s, _ := lc.snapshot.Load().(*Snapshot)
+	return s
 }
 
-// Unlock used to unlock after reading/updating metrics
-func (lc *LCC) Unlock() {
-	lc.mux.Unlock()
+// Collecting reports whether a collection cycle is in progress
+func (lc *LCC) Collecting() bool {
+	return atomic.LoadInt32(&lc.collecting) == 1
 }
 
 func getSingleSampleResult(sample []*logcache_v1.PromQL_Sample) float64 {
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	logcache "code.cloudfoundry.org/log-cache/pkg/client"
+	"code.cloudfoundry.org/log-cache/pkg/rpc/logcache_v1"
+	"github.com/blang/semver"
+)
+
+// blockingReader answers every query with value.  While gate is set queries wait for it
+// to be closed
+type blockingReader struct {
+	mux      sync.Mutex
+	gate     chan struct{}
+	value    float64
+	inFlight int32
+	peak     int32
+	started  chan struct{}
+}
+
+func (b *blockingReader) PromQL(ctx context.Context, query string, opts ...logcache.PromQLOption) (*logcache_v1.PromQL_InstantQueryResult, error) {
+	n := atomic.AddInt32(&b.inFlight, 1)
+	defer atomic.AddInt32(&b.inFlight, -1)
+	b.mux.Lock()
+	gate, v := b.gate, b.value
+	if n > b.peak {
+		b.peak = n
+	}
+	b.mux.Unlock()
+	if gate != nil {
+		select {
+		case b.started <- struct{}{}:
+		default:
+		}
+		select {
+		case <-gate:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return &logcache_v1.PromQL_InstantQueryResult{
+		Result: &logcache_v1.PromQL_InstantQueryResult_Vector{Vector: &logcache_v1.PromQL_Vector{
+			Samples: []*logcache_v1.PromQL_Sample{{Metric: map[string]string{}, Point: &logcache_v1.PromQL_Point{Value: v}}},
+		}},
+	}, nil
+}
+
+func (b *blockingReader) PromQLRange(ctx context.Context, query string, opts ...logcache.PromQLOption) (*logcache_v1.PromQL_RangeQueryResult, error) {
+	return nil, fmt.Errorf("no range queries")
+}
+
+func (b *blockingReader) Meta(ctx context.Context) (map[string]*logcache_v1.MetaInfo, error) {
+	return map[string]*logcache_v1.MetaInfo{}, nil
+}
+
+func (b *blockingReader) LogCacheVersion(ctx context.Context) (semver.Version, error) {
+	return semver.Version{}, fmt.Errorf("no version")
+}
+
+// set changes the value returned and whether queries block
+func (b *blockingReader) set(v float64, gate chan struct{}) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.value, b.gate = v, gate
+}
+
+func TestCollectSnapshotSwap(t *testing.T) {
+	window := *trendWindow
+	*trendWindow = 0
+	defer func() { *trendWindow = window }()
+	catalog, err := LoadCatalog("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := &blockingReader{started: make(chan struct{}, 1)}
+	lcc := &LCC{Concurrency: 2, CycleTimeout: time.Minute, client: reader, mutualTLS: true, Catalog: catalog}
+	if err := lcc.SelectProfile("syslog-agent"); err != nil {
+		t.Fatal(err)
+	}
+	if lcc.Snapshot() != nil || lcc.Collecting() {
+		t.Fatal("expected no snapshot before the first collection")
+	}
+
+	reader.set(100, nil)
+	lcc.Collect()
+	first := lcc.Snapshot()
+	if first == nil || first.Metric.Doppler.Ingress != 100 {
+		t.Fatalf("expected the first snapshot to hold ingress 100 got %v", first)
+	}
+
+	gate := make(chan struct{})
+	reader.set(200, gate)
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lcc.Collect()
+		}()
+	}
+	select {
+	case <-reader.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the second collection to start")
+	}
+	// give an overlapping cycle time to issue its queries
+	time.Sleep(50 * time.Millisecond)
+	if !lcc.Collecting() {
+		t.Error("expected a collection in progress")
+	}
+	if s := lcc.Snapshot(); s != first {
+		t.Errorf("expected the previous snapshot while collecting got ingress %v", s.Metric.Doppler.Ingress)
+	}
+	if n := atomic.LoadInt32(&reader.inFlight); n > int32(lcc.Concurrency) {
+		t.Errorf("expected one cycle at a time with %d queries in flight got %d", lcc.Concurrency, n)
+	}
+
+	close(gate)
+	wg.Wait()
+	if lcc.Collecting() {
+		t.Error("expected no collection in progress")
+	}
+	s := lcc.Snapshot()
+	if s == first || s.Metric.Doppler.Ingress != 200 {
+		t.Errorf("expected the new snapshot to be swapped in got ingress %v", s.Metric.Doppler.Ingress)
+	}
+	if reader.peak > int32(lcc.Concurrency) {
+		t.Errorf("expected at most %d queries in flight got %d", lcc.Concurrency, reader.peak)
+	}
+	if first.Metric.Doppler.Ingress != 100 {
+		t.Errorf("expected the previous snapshot to be left unchanged got ingress %v", first.Metric.Doppler.Ingress)
+	}
+}
+
+// vectorReader answers instant queries with the samples stored for them
+type vectorReader struct {
+	blockingReader
+	results map[string][]*logcache_v1.PromQL_Sample
+}
+
+func (v *vectorReader) PromQL(ctx context.Context, query string, opts ...logcache.PromQLOption) (*logcache_v1.PromQL_InstantQueryResult, error) {
+	samples, ok := v.results[query]
+	if !ok {
+		return nil, fmt.Errorf("no result")
+	}
+	return &logcache_v1.PromQL_InstantQueryResult{
+		Result: &logcache_v1.PromQL_InstantQueryResult_Vector{Vector: &logcache_v1.PromQL_Vector{Samples: samples}},
+	}, nil
+}
+
+// promSample sample with labels given as name, value pairs
+func promSample(v float64, labels ...string) *logcache_v1.PromQL_Sample {
+	m := make(map[string]string)
+	for i := 0; i+1 < len(labels); i += 2 {
+		m[labels[i]] = labels[i+1]
+	}
+	return &logcache_v1.PromQL_Sample{Metric: m, Point: &logcache_v1.PromQL_Point{Value: v}}
+}
+
+// runCollector runs collect against results with the default offset and duration and
+// returns the collection errors
+func runCollector(t *testing.T, results map[string][]*logcache_v1.PromQL_Sample, collect func(lc *LCC, p *queryPool)) []error {
+	t.Helper()
+	lc := &LCC{client: &vectorReader{results: results}, mutualTLS: true}
+	p := newQueryPool(context.Background(), 4)
+	collect(lc, p)
+	p.Wait()
+	return p.Errors()
+}
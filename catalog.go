@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// CatalogEntry a single value the collector queries.  Built in entries are bound to a
+// field of Metrics, any other entry is collected into Metrics.Custom
+type CatalogEntry struct {
+	Panel       string            `json:"panel"`
+	Field       string            `json:"field"`
+	Label       string            `json:"label,omitempty"`
+	Metric      string            `json:"metric"`
+	SourceID    string            `json:"source_id"`        // {agent} is replaced by the profile agent source id
+	Job         string            `json:"job,omitempty"`    // bosh job label
+	Labels      map[string]string `json:"labels,omitempty"` // extra label matchers
+	Aggregation string            `json:"aggregation,omitempty"`
+	Query       string            `json:"query,omitempty"`  // query template used instead of aggregation
+	Window      string            `json:"window,omitempty"` // overrides the sample duration
+	Unit        string            `json:"unit,omitempty"`
+	Requires    string            `json:"requires,omitempty"` // syslog-agent or syslog-adapter
+}
+
+// Key panel.field used to override built in entries
+func (e CatalogEntry) Key() string {
+	return e.Panel + "." + e.Field
+}
+
+// Catalog list of entries collected every cycle
+type Catalog []CatalogEntry
+
+// CustomMetric value of a catalog entry that is not bound to a Metrics field
+type CustomMetric struct {
+	Panel string  `json:"panel"`
+	Field string  `json:"field"`
+	Label string  `json:"label"`
+	Unit  string  `json:"unit"`
+	Value float64 `json:"value"`
+}
+
+// catalogAggregations query templates.  {selector} expands to the metric name and label
+// matchers, {window} to the sample duration, {offset} to the sample offset and {by} to
+// the grouping clause when --group-by is used
+var catalogAggregations = map[string]string{
+	"sum_rate": "sum(rate({selector}[{window}] offset {offset})){by}",
+	"avg_rate": "avg(rate({selector}[{window}] offset {offset})){by}",
+	"max_rate": "max(rate({selector}[{window}] offset {offset})){by}",
+	// averages gauges such as cpu and memory percentages over the window
+	"avg_over_time": "avg(avg_over_time({selector}[{window}] offset {offset})){by}",
+	"sum":           "sum({selector} offset {offset}){by}",
+	"avg":           "avg({selector} offset {offset}){by}",
+	"min":           "min({selector} offset {offset}){by}",
+	"max":           "max({selector} offset {offset}){by}",
+	"count":         "count({selector} offset {offset}){by}",
+}
+
+// catalogBindings built in entries and the Metrics field they populate
+var catalogBindings = map[string]func(m *Metrics, v float64){
+	"tc.count":                       func(m *Metrics, v float64) { m.TC.System.Count = int64(v) },
+	"tc.cpu_user":                    func(m *Metrics, v float64) { m.TC.System.CPUUser = v },
+	"tc.cpu_sys":                     func(m *Metrics, v float64) { m.TC.System.CPUSys = v },
+	"tc.cpu_wait":                    func(m *Metrics, v float64) { m.TC.System.CPUWait = v },
+	"tc.memory":                      func(m *Metrics, v float64) { m.TC.System.Memory = v },
+	"tc.app_streams":                 func(m *Metrics, v float64) { m.TC.AppStreams = v },
+	"tc.slow_consumers":              func(m *Metrics, v float64) { m.TC.SlowConsumers = v },
+	"tc.firehoses":                   func(m *Metrics, v float64) { m.TC.Firehoses = v },
+	"tc.ingress":                     func(m *Metrics, v float64) { m.TC.Ingress = v },
+	"tc.egress":                      func(m *Metrics, v float64) { m.TC.Egress = v },
+	"tc.container_latency_p50":       func(m *Metrics, v float64) { m.TC.ContainerLatency.P50 = v },
+	"tc.container_latency_p90":       func(m *Metrics, v float64) { m.TC.ContainerLatency.P90 = v },
+	"tc.container_latency_p99":       func(m *Metrics, v float64) { m.TC.ContainerLatency.P99 = v },
+	"doppler.count":                  func(m *Metrics, v float64) { m.Doppler.System.Count = int64(v) },
+	"doppler.cpu_user":               func(m *Metrics, v float64) { m.Doppler.System.CPUUser = v },
+	"doppler.cpu_sys":                func(m *Metrics, v float64) { m.Doppler.System.CPUSys = v },
+	"doppler.cpu_wait":               func(m *Metrics, v float64) { m.Doppler.System.CPUWait = v },
+	"doppler.memory":                 func(m *Metrics, v float64) { m.Doppler.System.Memory = v },
+	"doppler.ingress":                func(m *Metrics, v float64) { m.Doppler.Ingress = v },
+	"doppler.ingress_dropped":        func(m *Metrics, v float64) { m.Doppler.IngressDropped = v },
+	"doppler.egress":                 func(m *Metrics, v float64) { m.Doppler.Egress = v },
+	"doppler.dropped":                func(m *Metrics, v float64) { m.Doppler.Dropped = v },
+	"doppler.subscriptions":          func(m *Metrics, v float64) { m.Doppler.Subscriptions = v },
+	"doppler.dump_sinks":             func(m *Metrics, v float64) { m.Doppler.DumpSinks = v },
+	"doppler.sinks_dropped":          func(m *Metrics, v float64) { m.Doppler.SinksDropped = v },
+	"doppler.sink_errors_dropped":    func(m *Metrics, v float64) { m.Doppler.SinkErrorsDropped = v },
+	"drain.agent_ingress":            func(m *Metrics, v float64) { m.Drain.AgentIngress = v },
+	"drain.agent_egress":             func(m *Metrics, v float64) { m.Drain.AgentEgress = v },
+	"drain.agent_dropped":            func(m *Metrics, v float64) { m.Drain.AgentDropped = v },
+	"drain.agent_bindings":           func(m *Metrics, v float64) { m.Drain.AgentBindings = v },
+	"drain.agent_active_drains":      func(m *Metrics, v float64) { m.Drain.AgentActiveDrains = v },
+	"drain.agent_invalid_drains":     func(m *Metrics, v float64) { m.Drain.AgentInvalidDrains = v },
+	"drain.agent_blacklisted_drains": func(m *Metrics, v float64) { m.Drain.AgentBlacklistedDrains = v },
+	"drain.agent_non_app_drains":     func(m *Metrics, v float64) { m.Drain.AgentNonAppDrains = v },
+	"syslog_adapter.count":           func(m *Metrics, v float64) { m.SyslogAdapter.System.Count = int64(v) },
+	"syslog_adapter.cpu_user":        func(m *Metrics, v float64) { m.SyslogAdapter.System.CPUUser = v },
+	"syslog_adapter.cpu_sys":         func(m *Metrics, v float64) { m.SyslogAdapter.System.CPUSys = v },
+	"syslog_adapter.cpu_wait":        func(m *Metrics, v float64) { m.SyslogAdapter.System.CPUWait = v },
+	"syslog_adapter.memory":          func(m *Metrics, v float64) { m.SyslogAdapter.System.Memory = v },
+	"syslog_adapter.bindings":        func(m *Metrics, v float64) { m.SyslogAdapter.Bindings = v },
+	"syslog_adapter.ingress":         func(m *Metrics, v float64) { m.SyslogAdapter.Ingress = v },
+	"syslog_adapter.egress":          func(m *Metrics, v float64) { m.SyslogAdapter.Egress = v },
+	"syslog_adapter.dropped":         func(m *Metrics, v float64) { m.SyslogAdapter.Dropped = v },
+	"syslog_scheduler.count":         func(m *Metrics, v float64) { m.SyslogScheduler.System.Count = int64(v) },
+	"syslog_scheduler.cpu_user":      func(m *Metrics, v float64) { m.SyslogScheduler.System.CPUUser = v },
+	"syslog_scheduler.cpu_sys":       func(m *Metrics, v float64) { m.SyslogScheduler.System.CPUSys = v },
+	"syslog_scheduler.cpu_wait":      func(m *Metrics, v float64) { m.SyslogScheduler.System.CPUWait = v },
+	"syslog_scheduler.memory":        func(m *Metrics, v float64) { m.SyslogScheduler.System.Memory = v },
+	"syslog_scheduler.drains":        func(m *Metrics, v float64) { m.SyslogScheduler.Drains = v },
+	"metron.ingress":                 func(m *Metrics, v float64) { m.Metron.Ingress = v },
+	"metron.egress":                  func(m *Metrics, v float64) { m.Metron.Egress = v },
+	"metron.dropped":                 func(m *Metrics, v float64) { m.Metron.Dropped = v },
+	"rlp.ingress":                    func(m *Metrics, v float64) { m.RLP.Ingress = v },
+	"rlp.egress":                     func(m *Metrics, v float64) { m.RLP.Egress = v },
+	"rlp.dropped":                    func(m *Metrics, v float64) { m.RLP.Dropped = v },
+}
+
+// builtinCatalog panels shown by the terminal ui
+var builtinCatalog = `[
+  {"panel": "tc", "field": "count", "metric": "system_cpu_user", "source_id": "bosh-system-metrics-forwarder", "job": "loggregator_trafficcontroller", "aggregation": "count", "unit": "instances"},
+  {"panel": "tc", "field": "cpu_user", "metric": "system_cpu_user", "source_id": "bosh-system-metrics-forwarder", "job": "loggregator_trafficcontroller", "aggregation": "avg_over_time", "unit": "percent"},
+  {"panel": "tc", "field": "cpu_sys", "metric": "system_cpu_sys", "source_id": "bosh-system-metrics-forwarder", "job": "loggregator_trafficcontroller", "aggregation": "avg_over_time", "unit": "percent"},
+  {"panel": "tc", "field": "cpu_wait", "metric": "system_cpu_wait", "source_id": "bosh-system-metrics-forwarder", "job": "loggregator_trafficcontroller", "aggregation": "avg_over_time", "unit": "percent"},
+  {"panel": "tc", "field": "memory", "metric": "system_mem_percent", "source_id": "bosh-system-metrics-forwarder", "job": "loggregator_trafficcontroller", "aggregation": "avg_over_time", "unit": "percent"},
+  {"panel": "tc", "field": "app_streams", "metric": "doppler_proxy_app_streams", "source_id": "traffic_controller", "job": "loggregator_trafficcontroller", "aggregation": "sum", "unit": "streams"},
+  {"panel": "tc", "field": "slow_consumers", "metric": "doppler_proxy_slow_consumer", "source_id": "traffic_controller", "job": "loggregator_trafficcontroller", "aggregation": "avg_rate", "unit": "consumers/s"},
+  {"panel": "tc", "field": "firehoses", "metric": "doppler_proxy_firehoses", "source_id": "traffic_controller", "job": "loggregator_trafficcontroller", "aggregation": "sum", "unit": "subscriptions"},
+  {"panel": "tc", "field": "ingress", "metric": "ingress", "source_id": "traffic_controller", "job": "loggregator_trafficcontroller", "aggregation": "sum_rate", "unit": "envelopes/s"},
+  {"panel": "tc", "field": "egress", "metric": "egress", "source_id": "traffic_controller", "job": "loggregator_trafficcontroller", "aggregation": "sum_rate", "unit": "envelopes/s"},
+  {"panel": "tc", "field": "container_latency_p50", "metric": "doppler_proxy_container_metrics_latency", "source_id": "traffic_controller", "job": "loggregator_trafficcontroller", "query": "max(quantile_over_time(0.5, {selector}[{window}] offset {offset})){by}", "unit": "ms"},
+  {"panel": "tc", "field": "container_latency_p90", "metric": "doppler_proxy_container_metrics_latency", "source_id": "traffic_controller", "job": "loggregator_trafficcontroller", "query": "max(quantile_over_time(0.9, {selector}[{window}] offset {offset})){by}", "unit": "ms"},
+  {"panel": "tc", "field": "container_latency_p99", "metric": "doppler_proxy_container_metrics_latency", "source_id": "traffic_controller", "job": "loggregator_trafficcontroller", "query": "max(quantile_over_time(0.99, {selector}[{window}] offset {offset})){by}", "unit": "ms"},
+
+  {"panel": "doppler", "field": "count", "metric": "system_cpu_user", "source_id": "bosh-system-metrics-forwarder", "job": "doppler", "aggregation": "count", "unit": "instances"},
+  {"panel": "doppler", "field": "cpu_user", "metric": "system_cpu_user", "source_id": "bosh-system-metrics-forwarder", "job": "doppler", "aggregation": "avg_over_time", "unit": "percent"},
+  {"panel": "doppler", "field": "cpu_sys", "metric": "system_cpu_sys", "source_id": "bosh-system-metrics-forwarder", "job": "doppler", "aggregation": "avg_over_time", "unit": "percent"},
+  {"panel": "doppler", "field": "cpu_wait", "metric": "system_cpu_wait", "source_id": "bosh-system-metrics-forwarder", "job": "doppler", "aggregation": "avg_over_time", "unit": "percent"},
+  {"panel": "doppler", "field": "memory", "metric": "system_mem_percent", "source_id": "bosh-system-metrics-forwarder", "job": "doppler", "aggregation": "avg_over_time", "unit": "percent"},
+  {"panel": "doppler", "field": "ingress", "metric": "ingress", "source_id": "doppler", "job": "doppler", "aggregation": "sum_rate", "unit": "envelopes/s"},
+  {"panel": "doppler", "field": "ingress_dropped", "metric": "dropped", "source_id": "doppler", "labels": {"direction": "ingress"}, "query": "sum(max_over_time({selector}[{window}])) by (index) > 0", "unit": "envelopes"},
+  {"panel": "doppler", "field": "egress", "metric": "egress", "source_id": "doppler", "job": "doppler", "aggregation": "sum_rate", "unit": "envelopes/s"},
+  {"panel": "doppler", "field": "dropped", "metric": "dropped", "source_id": "doppler", "job": "doppler", "aggregation": "sum_rate", "unit": "envelopes/s"},
+  {"panel": "doppler", "field": "subscriptions", "metric": "subscriptions", "source_id": "doppler", "job": "doppler", "aggregation": "sum", "unit": "subscriptions"},
+  {"panel": "doppler", "field": "dump_sinks", "metric": "dump_sinks", "source_id": "doppler", "job": "doppler", "aggregation": "sum", "unit": "sinks"},
+  {"panel": "doppler", "field": "sinks_dropped", "metric": "sinks_dropped", "source_id": "doppler", "job": "doppler", "aggregation": "sum_rate", "unit": "envelopes/s"},
+  {"panel": "doppler", "field": "sink_errors_dropped", "metric": "sinks_errors_dropped", "source_id": "doppler", "job": "doppler", "aggregation": "sum_rate", "unit": "envelopes/s"},
+
+  {"panel": "drain", "field": "agent_ingress", "metric": "ingress", "source_id": "syslog_agent", "aggregation": "sum_rate", "unit": "envelopes/s", "requires": "syslog-agent"},
+  {"panel": "drain", "field": "agent_egress", "metric": "egress", "source_id": "syslog_agent", "aggregation": "sum_rate", "unit": "envelopes/s", "requires": "syslog-agent"},
+  {"panel": "drain", "field": "agent_dropped", "metric": "dropped", "source_id": "syslog_agent", "aggregation": "sum_rate", "unit": "envelopes/s", "requires": "syslog-agent"},
+  {"panel": "drain", "field": "agent_bindings", "metric": "drains", "source_id": "syslog_agent", "aggregation": "min", "unit": "drains", "requires": "syslog-agent"},
+  {"panel": "drain", "field": "agent_active_drains", "metric": "active_drains", "source_id": "syslog_agent", "aggregation": "min", "unit": "drains", "requires": "syslog-agent"},
+  {"panel": "drain", "field": "agent_invalid_drains", "metric": "invalid_drains", "source_id": "syslog_agent", "aggregation": "min", "unit": "drains", "requires": "syslog-agent"},
+  {"panel": "drain", "field": "agent_blacklisted_drains", "metric": "blacklisted_drains", "source_id": "syslog_agent", "aggregation": "min", "unit": "drains", "requires": "syslog-agent"},
+  {"panel": "drain", "field": "agent_non_app_drains", "metric": "non_app_drains", "source_id": "syslog_agent", "aggregation": "min", "unit": "drains", "requires": "syslog-agent"},
+
+  {"panel": "syslog_adapter", "field": "count", "metric": "system_cpu_user", "source_id": "bosh-system-metrics-forwarder", "job": "syslog_adapter", "aggregation": "count", "unit": "instances", "requires": "syslog-adapter"},
+  {"panel": "syslog_adapter", "field": "cpu_user", "metric": "system_cpu_user", "source_id": "bosh-system-metrics-forwarder", "job": "syslog_adapter", "aggregation": "avg_over_time", "unit": "percent", "requires": "syslog-adapter"},
+  {"panel": "syslog_adapter", "field": "cpu_sys", "metric": "system_cpu_sys", "source_id": "bosh-system-metrics-forwarder", "job": "syslog_adapter", "aggregation": "avg_over_time", "unit": "percent", "requires": "syslog-adapter"},
+  {"panel": "syslog_adapter", "field": "cpu_wait", "metric": "system_cpu_wait", "source_id": "bosh-system-metrics-forwarder", "job": "syslog_adapter", "aggregation": "avg_over_time", "unit": "percent", "requires": "syslog-adapter"},
+  {"panel": "syslog_adapter", "field": "memory", "metric": "system_mem_percent", "source_id": "bosh-system-metrics-forwarder", "job": "syslog_adapter", "aggregation": "avg_over_time", "unit": "percent", "requires": "syslog-adapter"},
+  {"panel": "syslog_adapter", "field": "bindings", "metric": "drain_bindings", "source_id": "drain_adapter", "job": "syslog_adapter", "aggregation": "sum", "unit": "bindings", "requires": "syslog-adapter"},
+  {"panel": "syslog_adapter", "field": "ingress", "metric": "ingress", "source_id": "drain_adapter", "job": "syslog_adapter", "aggregation": "sum_rate", "unit": "envelopes/s", "requires": "syslog-adapter"},
+  {"panel": "syslog_adapter", "field": "egress", "metric": "egress", "source_id": "drain_adapter", "job": "syslog_adapter", "aggregation": "sum_rate", "unit": "envelopes/s", "requires": "syslog-adapter"},
+  {"panel": "syslog_adapter", "field": "dropped", "metric": "dropped", "source_id": "drain_adapter", "job": "syslog_adapter", "aggregation": "sum_rate", "unit": "envelopes/s", "requires": "syslog-adapter"},
+  {"panel": "syslog_scheduler", "field": "count", "metric": "system_cpu_user", "source_id": "bosh-system-metrics-forwarder", "job": "syslog_scheduler", "aggregation": "count", "unit": "instances", "requires": "syslog-adapter"},
+  {"panel": "syslog_scheduler", "field": "cpu_user", "metric": "system_cpu_user", "source_id": "bosh-system-metrics-forwarder", "job": "syslog_scheduler", "aggregation": "avg_over_time", "unit": "percent", "requires": "syslog-adapter"},
+  {"panel": "syslog_scheduler", "field": "cpu_sys", "metric": "system_cpu_sys", "source_id": "bosh-system-metrics-forwarder", "job": "syslog_scheduler", "aggregation": "avg_over_time", "unit": "percent", "requires": "syslog-adapter"},
+  {"panel": "syslog_scheduler", "field": "cpu_wait", "metric": "system_cpu_wait", "source_id": "bosh-system-metrics-forwarder", "job": "syslog_scheduler", "aggregation": "avg_over_time", "unit": "percent", "requires": "syslog-adapter"},
+  {"panel": "syslog_scheduler", "field": "memory", "metric": "system_mem_percent", "source_id": "bosh-system-metrics-forwarder", "job": "syslog_scheduler", "aggregation": "avg_over_time", "unit": "percent", "requires": "syslog-adapter"},
+  {"panel": "syslog_scheduler", "field": "drains", "metric": "drains", "source_id": "drain_scheduler", "job": "syslog_scheduler", "aggregation": "sum", "unit": "drains", "requires": "syslog-adapter"},
+
+  {"panel": "metron", "field": "ingress", "metric": "ingress", "source_id": "{agent}", "aggregation": "sum_rate", "unit": "envelopes/s"},
+  {"panel": "metron", "field": "egress", "metric": "egress", "source_id": "{agent}", "aggregation": "sum_rate", "unit": "envelopes/s"},
+  {"panel": "metron", "field": "dropped", "metric": "dropped", "source_id": "{agent}", "aggregation": "sum_rate", "unit": "envelopes/s"},
+
+  {"panel": "rlp", "field": "ingress", "metric": "ingress", "source_id": "reverse_log_proxy", "job": "loggregator_trafficcontroller", "aggregation": "sum_rate", "unit": "envelopes/s"},
+  {"panel": "rlp", "field": "egress", "metric": "egress", "source_id": "reverse_log_proxy", "job": "loggregator_trafficcontroller", "aggregation": "sum_rate", "unit": "envelopes/s"},
+  {"panel": "rlp", "field": "dropped", "metric": "dropped", "source_id": "reverse_log_proxy", "job": "loggregator_trafficcontroller", "aggregation": "sum_rate", "unit": "envelopes/s"}
+]`
+
+// LoadCatalog parses the built in catalog and merges the entries from path on top.
+// path may hold YAML or JSON.  Entries with the same panel and field replace the
+// built in entry
+func LoadCatalog(path string) (Catalog, error) {
+	var c Catalog
+	if err := json.Unmarshal([]byte(builtinCatalog), &c); err != nil {
+		return nil, fmt.Errorf("built in catalog: %s", err)
+	}
+	if path == "" {
+		return c, c.validate()
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read catalog: %s", err)
+	}
+	var user Catalog
+	if err := yaml.Unmarshal(b, &user); err != nil {
+		return nil, fmt.Errorf("could not parse catalog %s: %s", path, err)
+	}
+
+	index := make(map[string]int)
+	for i := range c {
+		index[c[i].Key()] = i
+	}
+	for _, e := range user {
+		if i, ok := index[e.Key()]; ok {
+			c[i] = e
+			continue
+		}
+		index[e.Key()] = len(c)
+		c = append(c, e)
+	}
+	return c, c.validate()
+}
+
+func (c Catalog) validate() error {
+	for _, e := range c {
+		if e.Panel == "" || e.Field == "" {
+			return fmt.Errorf("catalog entry for %s is missing a panel or field", e.Metric)
+		}
+		if e.Metric == "" || e.SourceID == "" {
+			return fmt.Errorf("catalog entry %s is missing a metric or source_id", e.Key())
+		}
+		if _, ok := catalogAggregations[e.Aggregation]; !ok && e.Query == "" {
+			return fmt.Errorf("catalog entry %s has unknown aggregation \"%s\" expected one of %s or a query", e.Key(), e.Aggregation, strings.Join(aggregationNames(), ", "))
+		}
+	}
+	return nil
+}
+
+func aggregationNames() []string {
+	names := make([]string, 0, len(catalogAggregations))
+	for n := range catalogAggregations {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Enabled reports whether the entry applies to the query profile
+func (e CatalogEntry) Enabled(p QueryProfile) bool {
+	switch e.Requires {
+	case "syslog-agent":
+		return p.SyslogAgent
+	case "syslog-adapter":
+		return p.SyslogAdapter
+	}
+	return true
+}
+
+// Grouped reports whether the entry can be split into one series per group
+func (e CatalogEntry) Grouped() bool {
+	return e.Query == "" || strings.Contains(e.Query, "{by}")
+}
+
+// Expand builds the promql query for the entry.  When by is not empty the query is
+// grouped by that label
+func (e CatalogEntry) Expand(p QueryProfile, offset, duration, by string) string {
+	sourceID := strings.Replace(e.SourceID, "{agent}", p.AgentSID, -1)
+	matchers := []string{fmt.Sprintf("source_id=\"%s\"", sourceID)}
+	if e.Job != "" {
+		matchers = append(matchers, fmt.Sprintf("job=\"%s\"", e.Job))
+	}
+	keys := make([]string, 0, len(e.Labels))
+	for k := range e.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		matchers = append(matchers, fmt.Sprintf("%s=\"%s\"", k, e.Labels[k]))
+	}
+
+	var selector string
+	if strings.Contains(e.Metric, "-") {
+		// dashes are not valid in promql identifiers
+		selector = fmt.Sprintf("{__name__=\"%s\",%s}", e.Metric, strings.Join(matchers, ","))
+	} else {
+		selector = fmt.Sprintf("%s{%s}", e.Metric, strings.Join(matchers, ","))
+	}
+
+	window := duration
+	if e.Window != "" {
+		window = e.Window
+	}
+	q := e.Query
+	if q == "" {
+		q = catalogAggregations[e.Aggregation]
+	}
+	var clause string
+	if by != "" {
+		clause = " by (" + by + ")"
+	}
+	return strings.NewReplacer("{selector}", selector, "{window}", window, "{offset}", offset, "{by}", clause).Replace(q)
+}
+
+// collectCatalog schedules a query for every enabled entry.  Bound entries are written
+// to m and the rest are appended to m.Custom
+func (lc *LCC) collectCatalog(p *queryPool, c Catalog, m *Metrics, offset, duration string) {
+	for _, e := range c {
+		if !e.Enabled(lc.Profile) {
+			continue
+		}
+		e := e
+		q := e.Expand(lc.Profile, offset, duration, "")
+		p.Go(q, func(ctx context.Context) error {
+			result, err := lc.GetQueryResult(ctx, q)
+			v := getSingleSampleResult(result.GetVector().GetSamples())
+			p.Do(func() {
+				if set, ok := catalogBindings[e.Key()]; ok {
+					set(m, v)
+					return
+				}
+				m.Custom = append(m.Custom, CustomMetric{Panel: e.Panel, Field: e.Field, Label: e.Label, Unit: e.Unit, Value: v})
+			})
+			return err
+		})
+	}
+}
+
+// sortCustomMetrics orders custom metrics by panel and field so they render in a stable order
+func sortCustomMetrics(c []CustomMetric) {
+	sort.SliceStable(c, func(i, j int) bool {
+		if c[i].Panel != c[j].Panel {
+			return c[i].Panel < c[j].Panel
+		}
+		return c[i].Field < c[j].Field
+	})
+}
+
+// startCatalog prints the catalog so it can be used as a starting point for a custom one
+func startCatalog(args []string) {
+	fs := flag.NewFlagSet("firehose-catalog-args", flag.ExitOnError)
+	file := fs.String("catalog", "", "Specify query catalog file")
+	fs.Usage = func() { fmt.Println(firehoseUsage) }
+	err := fs.Parse(args)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	c, err := LoadCatalog(*file)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Println(string(b))
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"code.cloudfoundry.org/log-cache/pkg/rpc/logcache_v1"
+)
+
+func TestLoadCatalog(t *testing.T) {
+	builtin, err := LoadCatalog("")
+	if err != nil {
+		t.Fatalf("LoadCatalog() built in error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		wantErr string
+		entries int
+		key     string
+		window  string
+	}{
+		{
+			name:    "yaml override",
+			file:    "- panel: doppler\n  field: ingress\n  metric: ingress\n  source_id: doppler\n  aggregation: sum_rate\n  window: 1m\n",
+			entries: len(builtin), key: "doppler.ingress", window: "1m",
+		},
+		{
+			name:    "json add",
+			file:    `[{"panel": "gorouter", "field": "latency", "metric": "latency", "source_id": "gorouter", "aggregation": "avg", "window": "2m"}]`,
+			entries: len(builtin) + 1, key: "gorouter.latency", window: "2m",
+		},
+		{
+			name:    "query template",
+			file:    "- {panel: uaa, field: requests, metric: requests, source_id: uaa, query: 'sum({selector})', window: 3m}\n",
+			entries: len(builtin) + 1, key: "uaa.requests", window: "3m",
+		},
+		{name: "missing metric", file: "- {panel: uaa, field: requests, source_id: uaa, aggregation: sum}\n", wantErr: "missing a metric"},
+		{name: "missing panel", file: "- {field: requests, metric: requests, source_id: uaa, aggregation: sum}\n", wantErr: "missing a panel"},
+		{name: "unknown aggregation", file: "- {panel: uaa, field: requests, metric: requests, source_id: uaa, aggregation: p99}\n", wantErr: "unknown aggregation"},
+		{name: "not a list", file: "panel: uaa\n", wantErr: "could not parse"},
+	}
+	dir, err := ioutil.TempDir("", "catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, string(rune('a'+i))+".yml")
+			if err := ioutil.WriteFile(path, []byte(tt.file), 0644); err != nil {
+				t.Fatal(err)
+			}
+			c, err := LoadCatalog(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadCatalog() error = %v, expected %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadCatalog() error = %v", err)
+			}
+			if len(c) != tt.entries {
+				t.Errorf("LoadCatalog() returned %d entries, expected %d", len(c), tt.entries)
+			}
+			found := false
+			for _, e := range c {
+				if e.Key() == tt.key {
+					found = true
+					if e.Window != tt.window {
+						t.Errorf("%s window = %s, expected %s", tt.key, e.Window, tt.window)
+					}
+				}
+			}
+			if !found {
+				t.Errorf("LoadCatalog() has no entry %s", tt.key)
+			}
+		})
+	}
+
+	if _, err := LoadCatalog(filepath.Join(dir, "missing.yml")); err == nil || !strings.Contains(err.Error(), "could not read catalog") {
+		t.Errorf("LoadCatalog() missing file error = %v", err)
+	}
+}
+
+func TestCatalogEntryExpand(t *testing.T) {
+	p := QueryProfile{AgentSID: "forwarder_agent"}
+	tests := []struct {
+		name  string
+		entry CatalogEntry
+		by    string
+		want  string
+	}{
+		{
+			name:  "aggregation",
+			entry: CatalogEntry{Metric: "ingress", SourceID: "doppler", Job: "doppler", Aggregation: "sum_rate"},
+			want:  `sum(rate(ingress{source_id="doppler",job="doppler"}[5m] offset 1m))`,
+		},
+		{
+			name:  "grouped",
+			entry: CatalogEntry{Metric: "system_cpu_user", SourceID: "bosh-system-metrics-forwarder", Aggregation: "avg_over_time"},
+			by:    "az",
+			want:  `avg(avg_over_time(system_cpu_user{source_id="bosh-system-metrics-forwarder"}[5m] offset 1m)) by (az)`,
+		},
+		{
+			name:  "agent source id and sorted labels",
+			entry: CatalogEntry{Metric: "dropped", SourceID: "{agent}", Labels: map[string]string{"direction": "ingress", "deployment": "cf"}, Aggregation: "sum"},
+			want:  `sum(dropped{source_id="forwarder_agent",deployment="cf",direction="ingress"} offset 1m)`,
+		},
+		{
+			name:  "dashed metric name",
+			entry: CatalogEntry{Metric: "cpu-user", SourceID: "uaa", Aggregation: "max"},
+			want:  `max({__name__="cpu-user",source_id="uaa"} offset 1m)`,
+		},
+		{
+			name:  "query template and window",
+			entry: CatalogEntry{Metric: "latency", SourceID: "gorouter", Window: "1m", Query: "max(max_over_time({selector}[{window}]))"},
+			by:    "index",
+			want:  `max(max_over_time(latency{source_id="gorouter"}[1m]))`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.entry.Expand(p, "1m", "5m", tt.by); got != tt.want {
+				t.Errorf("Expand() = %s, expected %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCatalogBindings(t *testing.T) {
+	c, err := LoadCatalog("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make(map[string]bool)
+	for _, e := range c {
+		if keys[e.Key()] {
+			t.Errorf("built in catalog has %s twice", e.Key())
+		}
+		keys[e.Key()] = true
+		if _, ok := catalogBindings[e.Key()]; !ok {
+			t.Errorf("built in entry %s is not bound to a Metrics field", e.Key())
+		}
+	}
+	for k := range catalogBindings {
+		if !keys[k] {
+			t.Errorf("binding %s has no built in entry", k)
+		}
+	}
+
+	tests := []struct {
+		key  string
+		want func(m *Metrics) float64
+	}{
+		{key: "doppler.count", want: func(m *Metrics) float64 { return float64(m.Doppler.System.Count) }},
+		{key: "tc.container_latency_p99", want: func(m *Metrics) float64 { return m.TC.ContainerLatency.P99 }},
+		{key: "drain.agent_dropped", want: func(m *Metrics) float64 { return m.Drain.AgentDropped }},
+		{key: "rlp.egress", want: func(m *Metrics) float64 { return m.RLP.Egress }},
+	}
+	for _, tt := range tests {
+		m := &Metrics{}
+		catalogBindings[tt.key](m, 7)
+		if got := tt.want(m); got != 7 {
+			t.Errorf("binding %s set %v, expected 7", tt.key, got)
+		}
+	}
+}
+
+// collectPanel runs the built in catalog entries of panel that have a value in values
+// against a reader answering each with its value
+func collectPanel(t *testing.T, profile, panel string, values map[string]float64) Metrics {
+	t.Helper()
+	builtin, err := LoadCatalog("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := queryProfiles[profile]
+	c := make(Catalog, 0)
+	results := make(map[string][]*logcache_v1.PromQL_Sample)
+	for _, e := range builtin {
+		v, ok := values[e.Field]
+		if e.Panel != panel || !ok || !e.Enabled(p) {
+			continue
+		}
+		c = append(c, e)
+		results[e.Expand(p, "2m", "5m", "")] = []*logcache_v1.PromQL_Sample{promSample(v)}
+	}
+	if len(c) != len(values) {
+		t.Fatalf("expected %d %s entries enabled with %s got %d", len(values), panel, profile, len(c))
+	}
+	var m Metrics
+	errs := runCollector(t, results, func(lc *LCC, pool *queryPool) {
+		lc.Profile = p
+		lc.collectCatalog(pool, c, &m, "2m", "5m")
+	})
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+	return m
+}
+
+func TestTrafficControllerPanel(t *testing.T) {
+	m := collectPanel(t, "syslog-agent", "tc", map[string]float64{
+		"firehoses": 2, "app_streams": 30, "slow_consumers": 0.5, "ingress": 900, "egress": 850,
+		"container_latency_p50": 5, "container_latency_p90": 20, "container_latency_p99": 80,
+	})
+	want := TrafficControllerMetrics{
+		Firehoses: 2, AppStreams: 30, SlowConsumers: 0.5, Ingress: 900, Egress: 850,
+		ContainerLatency: LatencyQuantiles{P50: 5, P90: 20, P99: 80},
+	}
+	if !reflect.DeepEqual(m.TC, want) {
+		t.Errorf("expected %+v got %+v", want, m.TC)
+	}
+	report := renderReport(&Snapshot{Profile: "syslog-agent", Metric: m}, "", "")
+	for _, line := range []string{
+		"Firehose Subscriptions          : 2\n",
+		"App Streams                     : 30\n",
+		"Slow Consumers/s                : 0.50\n",
+		"Container Metrics Latency       : p50=5ms p90=20ms p99=80ms\n",
+	} {
+		if !strings.Contains(report, line) {
+			t.Errorf("expected %q in the report", line)
+		}
+	}
+}
+
+func TestDopplerSinkPanel(t *testing.T) {
+	m := collectPanel(t, "syslog-agent", "doppler", map[string]float64{
+		"ingress": 1000, "dropped": 1, "dump_sinks": 4, "sinks_dropped": 20, "sink_errors_dropped": 10,
+	})
+	d := m.Doppler
+	if d.DumpSinks != 4 || d.SinksDropped != 20 || d.SinkErrorsDropped != 10 {
+		t.Fatalf("expected 4 sinks with 20/s and 10/s dropped got %+v", d)
+	}
+	// sink drops are kept apart from the doppler's own ingress drops
+	if d.IngressLoss() != 0.001 || d.SinkLoss() != 0.03 {
+		t.Errorf("expected ingress loss 0.001 and sink loss 0.03 got %v and %v", d.IngressLoss(), d.SinkLoss())
+	}
+	checks := evaluateChecks(&Snapshot{Profile: "syslog-agent", Metric: m})
+	if checks[0].Name != "Doppler ingress loss" || checks[0].Status != CheckOK {
+		t.Errorf("expected the doppler ingress loss to be OK got %+v", checks[0])
+	}
+	if checks[1].Name != "Doppler sink loss" || checks[1].Status == CheckOK {
+		t.Errorf("expected the doppler sink loss to be flagged got %+v", checks[1])
+	}
+	report := renderReport(&Snapshot{Profile: "syslog-agent", Metric: m}, "", "")
+	if !strings.Contains(report, "Doppler Sinks\t4\t\tN/A\t\tN/A\t\t30\t\t0.03\t(sinks dropped 20/s, sink errors dropped 10/s)") {
+		t.Errorf("expected the doppler sinks row in the report")
+	}
+}
+
+func TestSyslogAdapterPanel(t *testing.T) {
+	builtin, err := LoadCatalog("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range builtin {
+		if (e.Panel == "syslog_adapter" || e.Panel == "syslog_scheduler") && e.Enabled(queryProfiles["syslog-agent"]) {
+			t.Errorf("%s is queried on foundations without cf-syslog-drain", e.Key())
+		}
+	}
+
+	m := collectPanel(t, "legacy", "syslog_adapter", map[string]float64{"count": 2, "bindings": 40, "ingress": 500, "egress": 480, "dropped": 20})
+	m.SyslogScheduler = collectPanel(t, "legacy", "syslog_scheduler", map[string]float64{"count": 1, "drains": 42}).SyslogScheduler
+	if a := m.SyslogAdapter; a.System.Count != 2 || a.Bindings != 40 || a.Ingress != 500 || a.Egress != 480 || a.Dropped != 20 {
+		t.Errorf("unexpected syslog adapter metrics %+v", a)
+	}
+	if m.SyslogScheduler.System.Count != 1 || m.SyslogScheduler.Drains != 42 {
+		t.Errorf("unexpected syslog scheduler metrics %+v", m.SyslogScheduler)
+	}
+
+	s := &Snapshot{Profile: "legacy", Metric: m}
+	report := renderReport(s, "", "")
+	for _, want := range []string{
+		"Syslog Adapter drain bindings   : 40\n",
+		"Syslog Scheduler drains         : 42\n",
+		"Syslog Adapter\tN/A\t\t500\t\t480\t\t20\t\t0.04\n",
+		"Syslog Adapter         2",
+		"Syslog Scheduler       1",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("expected %q in the report", want)
+		}
+	}
+	if strings.Contains(report, "Syslog Agent") {
+		t.Error("expected no syslog agent rows with the legacy profile")
+	}
+	var adapterCheck bool
+	for _, c := range evaluateChecks(s) {
+		if c.Name == "Syslog Adapter loss" {
+			adapterCheck = c.Status == CheckWarning
+		}
+	}
+	if !adapterCheck {
+		t.Error("expected a 4% syslog adapter loss to be a warning")
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// loss ratios that fail a health check
+const (
+	lossWarn = 0.01
+	lossCrit = 0.05
+)
+
+// CheckStatus result of a health check.  The worst status is used as the exit code
+// of a one-shot run
+type CheckStatus int
+
+const (
+	CheckOK CheckStatus = iota
+	CheckWarning
+	CheckCritical
+	CheckUnknown // the run failed before a report could be produced
+)
+
+func (c CheckStatus) String() string {
+	switch c {
+	case CheckWarning:
+		return "WARNING"
+	case CheckCritical:
+		return "CRITICAL"
+	case CheckUnknown:
+		return "UNKNOWN"
+	default:
+		return "OK"
+	}
+}
+
+// Check outcome of a single health check
+type Check struct {
+	Name   string      `json:"name"`
+	Status CheckStatus `json:"status"`
+	Detail string      `json:"detail"`
+}
+
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// lossCheck compares the loss ratio against lossWarn and lossCrit
+func lossCheck(name string, dropped, ingress float64) Check {
+	c := Check{Name: name + " loss"}
+	if ingress <= 0 {
+		c.Detail = "no ingress"
+		return c
+	}
+	loss := dropped / ingress
+	c.Detail = fmt.Sprintf("%.2f%% of %.0f/s dropped", loss*100, ingress)
+	switch {
+	case loss >= lossCrit:
+		c.Status = CheckCritical
+	case loss >= lossWarn:
+		c.Status = CheckWarning
+	}
+	return c
+}
+
+// evaluateChecks runs the health checks against a snapshot
+func evaluateChecks(s *Snapshot) []Check {
+	m := s.Metric
+	checks := []Check{
+		lossCheck("Doppler ingress", m.Doppler.Dropped, m.Doppler.Ingress),
+		lossCheck("Doppler sink", m.Doppler.SinksDropped+m.Doppler.SinkErrorsDropped, m.Doppler.Ingress),
+		lossCheck("Metron", m.Metron.Dropped, m.Metron.Ingress),
+		lossCheck("RLP", m.RLP.Dropped, m.RLP.Ingress),
+	}
+	if queryProfiles[s.Profile].SyslogAdapter {
+		checks = append(checks, lossCheck("Syslog Adapter", m.SyslogAdapter.Dropped, m.SyslogAdapter.Ingress))
+	} else {
+		checks = append(checks, lossCheck("Syslog Agent", m.Drain.AgentDropped, m.Drain.AgentIngress))
+	}
+
+	for _, j := range m.System {
+		if warnings, critical := j.HealthWarnings(); len(warnings) > 0 {
+			c := Check{Name: j.Name + " vm health", Status: CheckWarning, Detail: strings.Join(warnings, ", ")}
+			if critical {
+				c.Status = CheckCritical
+			}
+			checks = append(checks, c)
+		}
+		if j.CPUUserSpread.Imbalanced() {
+			checks = append(checks, Check{Name: j.Name + " hot spot", Status: CheckWarning,
+				Detail: fmt.Sprintf("%s cpu user %.2f vs average %.2f", j.CPUUserSpread.Worst, j.CPUUserSpread.Max, j.CPUUserSpread.Mean)})
+		}
+	}
+
+	for _, d := range m.DopplerSkew.Hot(*skewThreshold) {
+		checks = append(checks, Check{Name: "Doppler skew", Status: CheckWarning,
+			Detail: fmt.Sprintf("%s is taking %.1fx the mean doppler ingress", d.Name, d.IngressRatio)})
+	}
+
+	for _, n := range m.LogCache {
+		if n.Evicting(*lcRetention) {
+			checks = append(checks, Check{Name: "Log Cache retention", Status: CheckWarning,
+				Detail: fmt.Sprintf("%s holds %s, expected %s", n.Name, n.Period().Round(time.Second), *lcRetention)})
+		}
+		if n.MemoryPressure() >= lcMemoryPressureWarn {
+			checks = append(checks, Check{Name: "Log Cache memory", Status: CheckWarning,
+				Detail: fmt.Sprintf("%s memory %.0f%% used", n.Name, n.MemoryPressure()*100)})
+		}
+	}
+
+	return append(checks, collectionCheck(s))
+}
+
+// collectionCheck warns about failed queries.  It is critical when every query failed
+// or no doppler or agent ingress was collected since the loss checks then pass on no data
+func collectionCheck(s *Snapshot) Check {
+	c := Check{Name: "Collection", Detail: fmt.Sprintf("%d queries", len(s.Queries))}
+	failed := 0
+	for _, q := range s.Queries {
+		if q.Error != "" {
+			failed++
+		}
+	}
+	missing := make([]string, 0)
+	if s.Metric.Doppler.Ingress <= 0 {
+		missing = append(missing, "doppler")
+	}
+	if s.Metric.Metron.Ingress <= 0 {
+		missing = append(missing, "agent")
+	}
+	switch {
+	case len(s.Queries) > 0 && failed == len(s.Queries):
+		c.Status, c.Detail = CheckCritical, fmt.Sprintf("all %d queries failed", failed)
+	case len(missing) > 0:
+		c.Status, c.Detail = CheckCritical, fmt.Sprintf("no %s ingress collected", strings.Join(missing, " or "))
+		if len(s.CollectionErrors) > 0 {
+			c.Detail += fmt.Sprintf(", %d queries failed", len(s.CollectionErrors))
+		}
+	case len(s.CollectionErrors) > 0:
+		c.Status, c.Detail = CheckWarning, fmt.Sprintf("%d queries failed", len(s.CollectionErrors))
+	}
+	return c
+}
+
+// worstStatus highest status among checks
+func worstStatus(checks []Check) CheckStatus {
+	worst := CheckOK
+	for _, c := range checks {
+		if c.Status > worst {
+			worst = c.Status
+		}
+	}
+	return worst
+}
+
+// checkStats renders every check that did not pass followed by the overall status
+func checkStats(checks []Check) string {
+	stats := "Health Checks\n"
+	stats += "----------------------------------------------------------------------------------------\n"
+	for _, c := range checks {
+		if c.Status == CheckOK {
+			continue
+		}
+		stats += fmt.Sprintf("%-9s %-28s %s\n", c.Status, c.Name, c.Detail)
+	}
+	stats += fmt.Sprintf("Overall status: %s (%d checks)\n", worstStatus(checks), len(checks))
+	return stats
+}
+
+// reporting set by commands that exit with the check status so setup failures exit
+// with CheckUnknown instead of a code that reads as a warning or critical report
+var reporting bool
+
+// onceRequested reports whether args enable --once.  It is used before the flags are
+// parsed so a bad flag still exits with the right code
+func onceRequested(args []string) bool {
+	for _, a := range args {
+		if a == "--" {
+			break
+		}
+		name := strings.TrimLeft(a, "-")
+		if name == a {
+			continue
+		}
+		if name == "once" {
+			return true
+		}
+		if strings.HasPrefix(name, "once=") {
+			v, err := strconv.ParseBool(strings.TrimPrefix(name, "once="))
+			return err != nil || v
+		}
+	}
+	return false
+}
+
+// setupExitCode exit code of a run that failed before collecting
+func setupExitCode() int {
+	if reporting {
+		return int(CheckUnknown)
+	}
+	return 1
+}
+
+// fatalln logs v and exits with setupExitCode
+func fatalln(v ...interface{}) {
+	logger.Output(2, fmt.Sprintln(v...))
+	os.Exit(setupExitCode())
+}
+
+// fatalf logs the formatted message and exits with setupExitCode
+func fatalf(format string, v ...interface{}) {
+	logger.Output(2, fmt.Sprintf(format, v...))
+	os.Exit(setupExitCode())
+}
+
+// parseFlags parses args into fs and exits with setupExitCode when they are invalid
+func parseFlags(fs *flag.FlagSet, args []string) {
+	err := fs.Parse(args)
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
+	if err != nil {
+		os.Exit(setupExitCode())
+	}
+}
+
+// runOnce collects a single snapshot, prints a static report and returns the exit code
+func runOnce(lcc *LCC) int {
+	collectAndRecord(lcc)
+	return reportSnapshot(lcc.Snapshot())
+}
+
+// reportSnapshot prints s as a static report or json document and returns the exit code
+func reportSnapshot(s *Snapshot) int {
+	checks := evaluateChecks(s)
+	if *format == formatJSON {
+		if err := writeSnapshotJSON(os.Stdout, s, true); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return int(CheckUnknown)
+		}
+		return int(worstStatus(checks))
+	}
+	fmt.Print(ansiEscape.ReplaceAllString(renderReport(s, s.ProfileReason, ""), ""))
+	fmt.Print(checkStats(checks))
+	return int(worstStatus(checks))
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestLossCheck(t *testing.T) {
+	tests := []struct {
+		name             string
+		dropped, ingress float64
+		want             CheckStatus
+	}{
+		{"no ingress", 10, 0, CheckOK},
+		{"no loss", 0, 1000, CheckOK},
+		{"below warning", 9, 1000, CheckOK},
+		{"warning", 10, 1000, CheckWarning},
+		{"critical", 50, 1000, CheckCritical},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lossCheck("Doppler", tt.dropped, tt.ingress); got.Status != tt.want {
+				t.Errorf("expected %s got %s (%s)", tt.want, got.Status, got.Detail)
+			}
+		})
+	}
+}
+
+func TestCollectionCheck(t *testing.T) {
+	healthy := Metrics{Doppler: DopplerMetrics{Ingress: 1000}, Metron: MetronMetrics{Ingress: 1000}}
+	tests := []struct {
+		name       string
+		snapshot   Snapshot
+		want       CheckStatus
+		wantDetail string
+	}{
+		{
+			name:       "healthy",
+			snapshot:   Snapshot{Metric: healthy, Queries: []ExecutedQuery{{Query: "a"}, {Query: "b"}}},
+			want:       CheckOK,
+			wantDetail: "2 queries",
+		},
+		{
+			name: "some queries failed",
+			snapshot: Snapshot{Metric: healthy, Queries: []ExecutedQuery{{Query: "a"}, {Query: "b", Error: "timeout"}},
+				CollectionErrors: []error{errors.New("b: timeout")}},
+			want:       CheckWarning,
+			wantDetail: "1 queries failed",
+		},
+		{
+			name: "every query failed",
+			snapshot: Snapshot{Queries: []ExecutedQuery{{Query: "a", Error: "401"}, {Query: "b", Error: "401"}},
+				CollectionErrors: []error{errors.New("a: 401"), errors.New("b: 401")}},
+			want:       CheckCritical,
+			wantDetail: "all 2 queries failed",
+		},
+		{
+			name:       "no data",
+			snapshot:   Snapshot{Queries: []ExecutedQuery{{Query: "a"}}},
+			want:       CheckCritical,
+			wantDetail: "no doppler or agent ingress collected",
+		},
+		{
+			name:       "no agent data",
+			snapshot:   Snapshot{Metric: Metrics{Doppler: DopplerMetrics{Ingress: 1000}}, CollectionErrors: []error{errors.New("agent: timeout")}},
+			want:       CheckCritical,
+			wantDetail: "no agent ingress collected, 1 queries failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := collectionCheck(&tt.snapshot)
+			if got.Status != tt.want || got.Detail != tt.wantDetail {
+				t.Errorf("expected %s %q got %s %q", tt.want, tt.wantDetail, got.Status, got.Detail)
+			}
+			tt.snapshot.Profile = "syslog-agent"
+			if status := worstStatus(evaluateChecks(&tt.snapshot)); status != tt.want {
+				t.Errorf("expected overall status %s got %s", tt.want, status)
+			}
+		})
+	}
+}
+
+func TestOnceRequested(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{args: nil},
+		{args: []string{"-d", "10m"}},
+		{args: []string{"--once"}, want: true},
+		{args: []string{"-d", "10m", "-once"}, want: true},
+		{args: []string{"--once=true"}, want: true},
+		{args: []string{"--once=false"}},
+		{args: []string{"--once=maybe"}, want: true},
+		{args: []string{"--", "--once"}},
+		{args: []string{"--onceish"}},
+	}
+	for _, tt := range tests {
+		if got := onceRequested(tt.args); got != tt.want {
+			t.Errorf("onceRequested(%v) = %v, expected %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+// TestSetupExitCode runs commands that fail before collecting in a child process and
+// checks the exit code.  Reporting runs exit unknown, everything else exits 1
+func TestSetupExitCode(t *testing.T) {
+	if args := os.Getenv("FIREHOSE_ANALYZER_ARGS"); args != "" {
+		new(BasicPlugin).Run(nil, strings.Split(args, " "))
+		os.Exit(0)
+	}
+	tests := []struct {
+		args string
+		want int
+	}{
+		{args: "firehose-analyzer --once -l name", want: int(CheckUnknown)},
+		{args: "firehose-analyzer --once --no-such-flag", want: int(CheckUnknown)},
+		{args: "firehose-analyzer --once=true -a -1", want: int(CheckUnknown)},
+		{args: "firehose-analyzer -l name", want: 1},
+		{args: "firehose-analyzer --no-such-flag", want: 1},
+		{args: "firehose-analyzer analyze-files --profile legacy --catalog /no/such/catalog dumps", want: int(CheckUnknown)},
+		{args: "firehose-analyzer analyze-files --profile none dumps", want: int(CheckUnknown)},
+		{args: "firehose-analyzer import --no-such-flag capture", want: int(CheckUnknown)},
+		{args: "firehose-analyzer import /no/such/capture", want: int(CheckUnknown)},
+		{args: "firehose-analyzer nozzle --once -i 0", want: int(CheckUnknown)},
+		{args: "firehose-analyzer nozzle -i 0", want: 1},
+		{args: "firehose-analyzer --once -h", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.args, func(t *testing.T) {
+			cmd := exec.Command(os.Args[0], "-test.run=^TestSetupExitCode$")
+			cmd.Env = append(os.Environ(), "FIREHOSE_ANALYZER_ARGS="+tt.args)
+			err := cmd.Run()
+			code := 0
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				code = exitErr.ExitCode()
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if code != tt.want {
+				t.Errorf("exit code %d, expected %d", code, tt.want)
+			}
+		})
+	}
+}
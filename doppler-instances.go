@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// dopplerSortColumns columns the doppler instance table can be sorted by
+var dopplerSortColumns = []string{"name", "subscriptions", "ingress", "egress", "dropped", "ingress-dropped", "sink-dropped"}
+
+// collectDopplerInstances schedules the per doppler queries.  Results are stored in
+// instances keyed by the value of label
+func (lc *LCC) collectDopplerInstances(p *queryPool, label string, instances map[string]*DopplerMetrics) {
+	get := func(name string) *DopplerMetrics {
+		d, ok := instances[name]
+		if !ok {
+			d = &DopplerMetrics{Name: name}
+			instances[name] = d
+		}
+		return d
+	}
+	lc.grouped(p, label, ingressCounter, dopplerSID, dopplerJob, querySumRateJobBy, func(n string, v float64) { get(n).Ingress = v })
+	lc.grouped(p, label, egressCounter, dopplerSID, dopplerJob, querySumRateJobBy, func(n string, v float64) { get(n).Egress = v })
+	lc.grouped(p, label, droppedCounter, dopplerSID, dopplerJob, querySumRateJobBy, func(n string, v float64) { get(n).Dropped = v })
+	lc.grouped(p, label, droppedCounter, dopplerSID, dopplerJob, queryIngressDroppedBy, func(n string, v float64) { get(n).IngressDropped = v })
+	lc.grouped(p, label, subscriptionsGauge, dopplerSID, dopplerJob, querySumJobBy, func(n string, v float64) { get(n).Subscriptions = v })
+	lc.grouped(p, label, dumpSinksGauge, dopplerSID, dopplerJob, querySumJobBy, func(n string, v float64) { get(n).DumpSinks = v })
+	lc.grouped(p, label, sinksDroppedCounter, dopplerSID, dopplerJob, querySumRateJobBy, func(n string, v float64) { get(n).SinksDropped = v })
+	lc.grouped(p, label, sinkErrorsDroppedCounter, dopplerSID, dopplerJob, querySumRateJobBy, func(n string, v float64) { get(n).SinkErrorsDropped = v })
+}
+
+// dopplerInstanceList flattens the instance map into a slice sorted by column
+func dopplerInstanceList(instances map[string]*DopplerMetrics, column string) []DopplerMetrics {
+	d := make([]DopplerMetrics, 0, len(instances))
+	for _, i := range instances {
+		d = append(d, *i)
+	}
+	sortDopplerInstances(d, column)
+	return d
+}
+
+// sortDopplerInstances sorts by name ascending or by the given numeric column descending
+func sortDopplerInstances(d []DopplerMetrics, column string) {
+	value := func(m DopplerMetrics) float64 {
+		switch column {
+		case "subscriptions":
+			return m.Subscriptions
+		case "egress":
+			return m.Egress
+		case "dropped":
+			return m.Dropped
+		case "ingress-dropped":
+			return m.IngressDropped
+		case "sink-dropped":
+			return m.SinksDropped + m.SinkErrorsDropped
+		default:
+			return m.Ingress
+		}
+	}
+	sort.SliceStable(d, func(i, j int) bool {
+		if column == "name" {
+			return d[i].Name < d[j].Name
+		}
+		if value(d[i]) == value(d[j]) {
+			return d[i].Name < d[j].Name
+		}
+		return value(d[i]) > value(d[j])
+	})
+}
+
+func validSortColumn(column string, columns []string) error {
+	for i := range columns {
+		if columns[i] == column {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid sort column \"%s\" expected one of %v", column, columns)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSortDopplerInstances(t *testing.T) {
+	instances := []DopplerMetrics{
+		{Name: "doppler/1", Ingress: 100, Egress: 90, Dropped: 1, IngressDropped: 5, Subscriptions: 3, SinksDropped: 1, SinkErrorsDropped: 1},
+		{Name: "doppler/0", Ingress: 300, Egress: 10, Dropped: 4, IngressDropped: 0, Subscriptions: 3, SinksDropped: 0, SinkErrorsDropped: 5},
+		{Name: "doppler/2", Ingress: 200, Egress: 50, Dropped: 2, IngressDropped: 2, Subscriptions: 9, SinksDropped: 3, SinkErrorsDropped: 0},
+	}
+	tests := []struct {
+		column string
+		want   []string
+	}{
+		{column: "name", want: []string{"doppler/0", "doppler/1", "doppler/2"}},
+		{column: "ingress", want: []string{"doppler/0", "doppler/2", "doppler/1"}},
+		{column: "egress", want: []string{"doppler/1", "doppler/2", "doppler/0"}},
+		{column: "dropped", want: []string{"doppler/0", "doppler/2", "doppler/1"}},
+		{column: "ingress-dropped", want: []string{"doppler/1", "doppler/2", "doppler/0"}},
+		{column: "sink-dropped", want: []string{"doppler/0", "doppler/2", "doppler/1"}},
+		// ties are broken by name
+		{column: "subscriptions", want: []string{"doppler/2", "doppler/0", "doppler/1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.column, func(t *testing.T) {
+			d := append([]DopplerMetrics(nil), instances...)
+			sortDopplerInstances(d, tt.column)
+			got := make([]string, len(d))
+			for i := range d {
+				got[i] = d[i].Name
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sortDopplerInstances(%s) = %v, expected %v", tt.column, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDopplerInstanceList(t *testing.T) {
+	instances := map[string]*DopplerMetrics{
+		"b": {Name: "b", Ingress: 1},
+		"a": {Name: "a", Ingress: 2},
+	}
+	d := dopplerInstanceList(instances, "name")
+	if len(d) != 2 || d[0].Name != "a" || d[1].Name != "b" {
+		t.Errorf("dopplerInstanceList() = %v", d)
+	}
+	if len(dopplerInstanceList(nil, "ingress")) != 0 {
+		t.Errorf("dopplerInstanceList() of no instances is not empty")
+	}
+}
+
+func TestValidSortColumn(t *testing.T) {
+	tests := []struct {
+		column  string
+		wantErr bool
+	}{
+		{column: "ingress"},
+		{column: "sink-dropped"},
+		{column: "Ingress", wantErr: true},
+		{column: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := validSortColumn(tt.column, dopplerSortColumns); (err != nil) != tt.wantErr {
+			t.Errorf("validSortColumn(%q) error = %v, wantErr %v", tt.column, err, tt.wantErr)
+		}
+	}
+}
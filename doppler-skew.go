@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// DopplerShare a single doppler's share of the total ingress and subscriptions
+type DopplerShare struct {
+	Name              string  `json:"name"`
+	IngressShare      float64 `json:"ingress_share"`      // fraction of total ingress
+	SubscriptionShare float64 `json:"subscription_share"` // fraction of total subscriptions
+	IngressRatio      float64 `json:"ingress_ratio"`      // ingress as a multiple of the mean doppler ingress
+}
+
+// DopplerSkew how evenly agents spread load across dopplers.  The skew scores are the
+// coefficient of variation (stddev / mean) so 0 means perfectly even
+type DopplerSkew struct {
+	IngressCV      float64        `json:"ingress_cv"`
+	SubscriptionCV float64        `json:"subscription_cv"`
+	Shares         []DopplerShare `json:"shares"` // in the same order as Metrics.DopplerInstance
+}
+
+// Hot dopplers whose ingress is at least threshold times the mean
+func (s DopplerSkew) Hot(threshold float64) []DopplerShare {
+	hot := make([]DopplerShare, 0)
+	for _, d := range s.Shares {
+		if threshold > 0 && d.IngressRatio >= threshold {
+			hot = append(hot, d)
+		}
+	}
+	return hot
+}
+
+// dopplerSkew computes each doppler's share of ingress and subscriptions
+func dopplerSkew(instances []DopplerMetrics) DopplerSkew {
+	ingress := make([]float64, len(instances))
+	subscriptions := make([]float64, len(instances))
+	for i, d := range instances {
+		ingress[i] = d.Ingress
+		subscriptions[i] = d.Subscriptions
+	}
+	totalIngress, meanIngress, ingressCV := distribution(ingress)
+	totalSubscriptions, _, subscriptionCV := distribution(subscriptions)
+
+	skew := DopplerSkew{IngressCV: ingressCV, SubscriptionCV: subscriptionCV}
+	for _, d := range instances {
+		share := DopplerShare{Name: d.Name}
+		if totalIngress > 0 {
+			share.IngressShare = d.Ingress / totalIngress
+			share.IngressRatio = d.Ingress / meanIngress
+		}
+		if totalSubscriptions > 0 {
+			share.SubscriptionShare = d.Subscriptions / totalSubscriptions
+		}
+		skew.Shares = append(skew.Shares, share)
+	}
+	return skew
+}
+
+// distribution returns the total, mean and coefficient of variation of values
+func distribution(values []float64) (total, mean, cv float64) {
+	if len(values) == 0 {
+		return 0, 0, 0
+	}
+	for _, v := range values {
+		total += v
+	}
+	mean = total / float64(len(values))
+	if mean == 0 {
+		return total, mean, 0
+	}
+	var variance float64
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	return total, mean, math.Sqrt(variance/float64(len(values))) / mean
+}
+
+// validSkewThreshold the threshold is a multiple of the mean so it must be above 1
+func validSkewThreshold(threshold float64) error {
+	if threshold <= 1 {
+		return fmt.Errorf("invalid skew threshold %.2f expected a multiple of the mean greater than 1", threshold)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDopplerSkew(t *testing.T) {
+	tests := []struct {
+		name           string
+		instances      []DopplerMetrics
+		ingressCV      float64
+		subscriptionCV float64
+		ingressShares  []float64
+		ratios         []float64
+	}{
+		{
+			name:          "even",
+			instances:     []DopplerMetrics{{Name: "a", Ingress: 100, Subscriptions: 2}, {Name: "b", Ingress: 100, Subscriptions: 2}},
+			ingressShares: []float64{0.5, 0.5},
+			ratios:        []float64{1, 1},
+		},
+		{
+			name:           "skewed",
+			instances:      []DopplerMetrics{{Name: "a", Ingress: 300, Subscriptions: 4}, {Name: "b", Ingress: 100}},
+			ingressCV:      0.5,
+			subscriptionCV: 1,
+			ingressShares:  []float64{0.75, 0.25},
+			ratios:         []float64{1.5, 0.5},
+		},
+		{
+			name:          "no ingress",
+			instances:     []DopplerMetrics{{Name: "a"}, {Name: "b"}},
+			ingressShares: []float64{0, 0},
+			ratios:        []float64{0, 0},
+		},
+		{name: "no dopplers"},
+	}
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := dopplerSkew(tt.instances)
+			if !near(s.IngressCV, tt.ingressCV) || !near(s.SubscriptionCV, tt.subscriptionCV) {
+				t.Errorf("dopplerSkew() cv = %v/%v, expected %v/%v", s.IngressCV, s.SubscriptionCV, tt.ingressCV, tt.subscriptionCV)
+			}
+			if len(s.Shares) != len(tt.instances) {
+				t.Fatalf("dopplerSkew() returned %d shares, expected %d", len(s.Shares), len(tt.instances))
+			}
+			for i, share := range s.Shares {
+				if share.Name != tt.instances[i].Name {
+					t.Errorf("share %d is %s, expected %s", i, share.Name, tt.instances[i].Name)
+				}
+				if !near(share.IngressShare, tt.ingressShares[i]) || !near(share.IngressRatio, tt.ratios[i]) {
+					t.Errorf("share %s = %v/%v, expected %v/%v", share.Name, share.IngressShare, share.IngressRatio, tt.ingressShares[i], tt.ratios[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDopplerSkewHot(t *testing.T) {
+	s := DopplerSkew{Shares: []DopplerShare{{Name: "a", IngressRatio: 2.5}, {Name: "b", IngressRatio: 2}, {Name: "c", IngressRatio: 0.5}}}
+	tests := []struct {
+		threshold float64
+		hot       int
+	}{
+		{threshold: 2, hot: 2},
+		{threshold: 2.5, hot: 1},
+		{threshold: 3, hot: 0},
+		{threshold: 0, hot: 0},
+	}
+	for _, tt := range tests {
+		if got := s.Hot(tt.threshold); len(got) != tt.hot {
+			t.Errorf("Hot(%v) = %v, expected %d dopplers", tt.threshold, got, tt.hot)
+		}
+	}
+}
+
+func TestValidSkewThreshold(t *testing.T) {
+	tests := []struct {
+		threshold float64
+		wantErr   bool
+	}{
+		{threshold: 1.5},
+		{threshold: 1, wantErr: true},
+		{threshold: 0, wantErr: true},
+		{threshold: -2, wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := validSkewThreshold(tt.threshold); (err != nil) != tt.wantErr {
+			t.Errorf("validSkewThreshold(%v) error = %v, wantErr %v", tt.threshold, err, tt.wantErr)
+		}
+	}
+}
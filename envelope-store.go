@@ -0,0 +1,352 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sourceAliases v1 origins whose log-cache source id differs once the loggregator.
+// prefix is removed
+var sourceAliases = map[string]string{
+	"trafficcontroller": trafficControllerSID,
+	"rlp":               rlpSID,
+}
+
+// envelopeSeries a ValueMetric or CounterEvent series of a single origin/job/index
+type envelopeSeries struct {
+	labels  map[string]string // source_id, deployment, job, index, ip and envelope tags
+	counter bool
+	first   float64 // first gauge value
+	last    float64 // last gauge value or counter total
+	delta   float64 // sum of counter deltas
+}
+
+// value the rate of counters and gauges or the last gauge value and counter total
+func (s *envelopeSeries) value(rate bool, span time.Duration) float64 {
+	if !rate {
+		return s.last
+	}
+	if span <= 0 {
+		return 0
+	}
+	if s.counter {
+		return s.delta / span.Seconds()
+	}
+	return (s.last - s.first) / span.Seconds()
+}
+
+// envelopeStore rebuilds metric series from dropsonde envelopes so the same figures can
+// be computed without log-cache
+type envelopeStore struct {
+	mux    sync.Mutex
+	series map[string]*envelopeSeries
+	first  time.Time
+	last   time.Time
+	span   time.Duration // used instead of the envelope timestamps when set
+}
+
+func newEnvelopeStore() *envelopeStore {
+	return &envelopeStore{series: make(map[string]*envelopeSeries)}
+}
+
+// envelopeSourceID log-cache source id of an envelope
+func envelopeSourceID(e *Envelope) string {
+	if sid := e.Tags["source_id"]; sid != "" {
+		return sid
+	}
+	origin := strings.TrimPrefix(e.GetOrigin(), "loggregator.")
+	if sid, ok := sourceAliases[origin]; ok {
+		return sid
+	}
+	return origin
+}
+
+// Add records a ValueMetric or CounterEvent envelope.  Other events are ignored
+func (st *envelopeStore) Add(e *Envelope) {
+	var name string
+	var value, total float64
+	switch e.GetEventType() {
+	case EventTypeValueMetric:
+		name, value = e.GetValueMetric().GetName(), e.GetValueMetric().GetValue()
+	case EventTypeCounterEvent:
+		name, value = e.GetCounterEvent().GetName(), float64(e.GetCounterEvent().GetDelta())
+		total = float64(e.GetCounterEvent().GetTotal())
+	default:
+		return
+	}
+	labels := map[string]string{
+		"deployment": e.GetDeployment(),
+		"job":        e.GetJob(),
+		"index":      e.GetIndex(),
+		"ip":         e.GetIp(),
+	}
+	for k, v := range e.Tags {
+		labels[k] = v
+	}
+	labels["source_id"] = envelopeSourceID(e)
+	if labels["source_id"] == boshSystemMetricsSID {
+		// the forwarder emits system.cpu.user on the firehose and system_cpu_user to log-cache
+		name = strings.Replace(name, ".", "_", -1)
+	}
+	labels["__name__"] = name
+
+	st.mux.Lock()
+	defer st.mux.Unlock()
+	if e.Timestamp != nil {
+		t := time.Unix(0, e.GetTimestamp())
+		if st.first.IsZero() || t.Before(st.first) {
+			st.first = t
+		}
+		if t.After(st.last) {
+			st.last = t
+		}
+	}
+	key := seriesKey(labels)
+	s, ok := st.series[key]
+	if !ok {
+		s = &envelopeSeries{labels: labels, counter: e.GetEventType() == EventTypeCounterEvent, first: value}
+		st.series[key] = s
+	}
+	if s.counter {
+		s.delta += value
+		s.last = total
+	} else {
+		s.last = value
+	}
+}
+
+func seriesKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+"="+labels[k])
+	}
+	return strings.Join(parts, ",")
+}
+
+// Span time covered by the envelopes
+func (st *envelopeStore) Span() time.Duration {
+	if st.span > 0 {
+		return st.span
+	}
+	return st.last.Sub(st.first)
+}
+
+// Sources reports whether any envelope was received from sid
+func (st *envelopeStore) Sources() map[string]bool {
+	st.mux.Lock()
+	defer st.mux.Unlock()
+	sources := make(map[string]bool)
+	for _, s := range st.series {
+		sources[s.labels["source_id"]] = true
+	}
+	return sources
+}
+
+// match series of metric from sourceid whose labels match every matcher
+func (st *envelopeStore) match(metric, sourceid string, matchers map[string]string) []*envelopeSeries {
+	matched := make([]*envelopeSeries, 0)
+	for _, s := range st.series {
+		if s.labels["__name__"] != metric || s.labels["source_id"] != sourceid {
+			continue
+		}
+		ok := true
+		for k, v := range matchers {
+			if s.labels[k] != v {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			matched = append(matched, s)
+		}
+	}
+	return matched
+}
+
+// aggregate evaluates one of the catalog aggregations over the matched series grouped
+// by label.  An empty label returns a single group named "".  Series only keep their
+// last gauge value so _over_time aggregations use it
+func (st *envelopeStore) aggregate(aggregation, metric, sourceid string, matchers map[string]string, by string) (map[string]float64, error) {
+	rate := strings.HasSuffix(aggregation, "_rate")
+	op := strings.TrimSuffix(strings.TrimSuffix(aggregation, "_rate"), "_over_time")
+	groups := make(map[string][]float64)
+	for _, s := range st.match(metric, sourceid, matchers) {
+		var name string
+		if by != "" {
+			parts := make([]string, 0)
+			for _, l := range strings.Split(by, ",") {
+				parts = append(parts, s.labels[l])
+			}
+			name = strings.Join(parts, "/")
+		}
+		groups[name] = append(groups[name], s.value(rate, st.Span()))
+	}
+
+	result := make(map[string]float64)
+	for name, values := range groups {
+		var v float64
+		switch op {
+		case "sum", "avg":
+			for _, x := range values {
+				v += x
+			}
+			if op == "avg" {
+				v /= float64(len(values))
+			}
+		case "max", "min":
+			v = values[0]
+			for _, x := range values {
+				if (op == "max" && x > v) || (op == "min" && x < v) {
+					v = x
+				}
+			}
+		case "count":
+			v = float64(len(values))
+		default:
+			return nil, fmt.Errorf("aggregation %s is not available from envelopes", aggregation)
+		}
+		result[name] = v
+	}
+	return result, nil
+}
+
+// Metrics computes the catalog panels, system jobs, doppler and agent instances from
+// the stored series
+func (st *envelopeStore) Metrics(p QueryProfile, c Catalog, label string, jobs []string) (Metrics, []error) {
+	st.mux.Lock()
+	defer st.mux.Unlock()
+	var m Metrics
+	var errs []error
+	sum := func(aggregation, metric, sourceid string, matchers map[string]string) float64 {
+		v, err := st.aggregate(aggregation, metric, sourceid, matchers, "")
+		if err != nil {
+			errs = append(errs, err)
+		}
+		return v[""]
+	}
+	grouped := func(aggregation, metric, sourceid string, matchers map[string]string, by string, set func(name string, v float64)) {
+		v, err := st.aggregate(aggregation, metric, sourceid, matchers, by)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for name, x := range v {
+			set(name, x)
+		}
+	}
+
+	for _, e := range c {
+		if !e.Enabled(p) {
+			continue
+		}
+		if e.Query != "" {
+			// custom promql such as the latency quantiles can not be evaluated here
+			continue
+		}
+		matchers := map[string]string{}
+		for k, v := range e.Labels {
+			matchers[k] = v
+		}
+		if e.Job != "" {
+			matchers["job"] = e.Job
+		}
+		v := sum(e.Aggregation, e.Metric, strings.Replace(e.SourceID, "{agent}", p.AgentSID, -1), matchers)
+		if set, ok := catalogBindings[e.Key()]; ok {
+			set(&m, v)
+			continue
+		}
+		m.Custom = append(m.Custom, CustomMetric{Panel: e.Panel, Field: e.Field, Label: e.Label, Unit: e.Unit, Value: v})
+	}
+	sortCustomMetrics(m.Custom)
+
+	systemJobs := make(map[string]*InstanceMetrics)
+	job := func(name string) *InstanceMetrics {
+		j, ok := systemJobs[name]
+		if !ok {
+			j = &InstanceMetrics{Name: name}
+			systemJobs[name] = j
+		}
+		return j
+	}
+	system := func(aggregation, metric string, set func(j *InstanceMetrics, v float64)) {
+		grouped(aggregation, metric, boshSystemMetricsSID, nil, "job", func(n string, v float64) { set(job(n), v) })
+	}
+	system("count", cpuUserGauge, func(j *InstanceMetrics, v float64) { j.Count = int64(v) })
+	system("avg", cpuUserGauge, func(j *InstanceMetrics, v float64) { j.CPUUser = v })
+	system("avg", cpuSYSGauge, func(j *InstanceMetrics, v float64) { j.CPUSys = v })
+	system("avg", cpuWaitGauge, func(j *InstanceMetrics, v float64) { j.CPUWait = v })
+	system("avg", memoryPercentGauge, func(j *InstanceMetrics, v float64) { j.Memory = v })
+	system("max", diskSystemGauge, func(j *InstanceMetrics, v float64) { j.DiskSystem = v })
+	system("max", diskEphemeralGauge, func(j *InstanceMetrics, v float64) { j.DiskEphemeral = v })
+	system("max", diskPersistentGauge, func(j *InstanceMetrics, v float64) { j.DiskPersistent = v })
+	system("avg", load1mGauge, func(j *InstanceMetrics, v float64) { j.Load1m = v })
+	system("max", swapPercentGauge, func(j *InstanceMetrics, v float64) { j.Swap = v })
+	system("sum_rate", netBytesInCounter, func(j *InstanceMetrics, v float64) { j.NetBytesIn = v })
+	system("sum_rate", netBytesOutCounter, func(j *InstanceMetrics, v float64) { j.NetBytesOut = v })
+	system("sum_rate", netErrorsInCounter, func(j *InstanceMetrics, v float64) { j.NetErrors += v })
+	system("sum_rate", netErrorsOutCounter, func(j *InstanceMetrics, v float64) { j.NetErrors += v })
+	for _, s := range st.match(cpuUserGauge, boshSystemMetricsSID, nil) {
+		j := job(s.labels["job"])
+		j.cpuSamples = append(j.cpuSamples, instanceSample{Index: s.labels["index"], IP: s.labels["ip"], Value: s.value(false, 0)})
+	}
+	for _, s := range st.match(memoryPercentGauge, boshSystemMetricsSID, nil) {
+		j := job(s.labels["job"])
+		j.memorySamples = append(j.memorySamples, instanceSample{Index: s.labels["index"], IP: s.labels["ip"], Value: s.value(false, 0)})
+	}
+	m.System = systemJobList(systemJobs, jobs)
+
+	dopplers := make(map[string]*DopplerMetrics)
+	doppler := func(name string) *DopplerMetrics {
+		d, ok := dopplers[name]
+		if !ok {
+			d = &DopplerMetrics{Name: name}
+			dopplers[name] = d
+		}
+		return d
+	}
+	onDoppler := map[string]string{"job": dopplerJob}
+	grouped("sum_rate", ingressCounter, dopplerSID, onDoppler, label, func(n string, v float64) { doppler(n).Ingress = v })
+	grouped("sum_rate", egressCounter, dopplerSID, onDoppler, label, func(n string, v float64) { doppler(n).Egress = v })
+	grouped("sum_rate", droppedCounter, dopplerSID, onDoppler, label, func(n string, v float64) { doppler(n).Dropped = v })
+	grouped("sum_rate", droppedCounter, dopplerSID, map[string]string{"job": dopplerJob, "direction": "ingress"}, label, func(n string, v float64) { doppler(n).IngressDropped = v })
+	grouped("sum", subscriptionsGauge, dopplerSID, onDoppler, label, func(n string, v float64) { doppler(n).Subscriptions = v })
+	grouped("sum", dumpSinksGauge, dopplerSID, onDoppler, label, func(n string, v float64) { doppler(n).DumpSinks = v })
+	grouped("sum_rate", sinksDroppedCounter, dopplerSID, onDoppler, label, func(n string, v float64) { doppler(n).SinksDropped = v })
+	grouped("sum_rate", sinkErrorsDroppedCounter, dopplerSID, onDoppler, label, func(n string, v float64) { doppler(n).SinkErrorsDropped = v })
+	m.DopplerInstance = dopplerInstanceList(dopplers, "name")
+	m.DopplerSkew = dopplerSkew(m.DopplerInstance)
+	// the panel shows a dropped count like the live sum(max_over_time(...)) by (index)
+	// query, the largest counter total of any doppler, not a rate
+	grouped("sum", droppedCounter, dopplerSID, map[string]string{"direction": "ingress"}, "index", func(n string, v float64) {
+		if v > m.Doppler.IngressDropped {
+			m.Doppler.IngressDropped = v
+		}
+	})
+
+	metrons := make(map[string]*MetronMetrics)
+	metron := func(name string) *MetronMetrics {
+		a, ok := metrons[name]
+		if !ok {
+			parts := strings.SplitN(name, "/", 3)
+			a = &MetronMetrics{Name: name, Deployment: parts[0], Job: parts[1], Index: parts[2]}
+			metrons[name] = a
+		}
+		return a
+	}
+	grouped("sum_rate", ingressCounter, p.AgentSID, nil, metronInstanceLabels, func(n string, v float64) { metron(n).Ingress = v })
+	grouped("sum_rate", egressCounter, p.AgentSID, nil, metronInstanceLabels, func(n string, v float64) { metron(n).Egress = v })
+	grouped("sum_rate", droppedCounter, p.AgentSID, nil, metronInstanceLabels, func(n string, v float64) { metron(n).Dropped = v })
+	m.MetronInstance = metronInstanceList(metrons)
+
+	if m.Doppler.System.Count > 0 {
+		m.Doppler.MessageRateCapacity = m.Doppler.Ingress / float64(m.Doppler.System.Count)
+	}
+	return m, errs
+}
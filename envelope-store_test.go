@@ -0,0 +1,197 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+var storeStart = time.Date(2020, 1, 2, 3, 4, 0, 0, time.UTC)
+
+func gaugeEnvelope(origin, job, index, name string, value float64, at time.Duration) *Envelope {
+	return &Envelope{Origin: proto.String(origin), EventType: eventType(EventTypeValueMetric), Timestamp: proto.Int64(storeStart.Add(at).UnixNano()),
+		Deployment: proto.String("cf"), Job: proto.String(job), Index: proto.String(index), Ip: proto.String("10.0.0." + index),
+		ValueMetric: &ValueMetric{Name: proto.String(name), Value: proto.Float64(value), Unit: proto.String("")}}
+}
+
+func counterEnvelope(origin, job, index, name string, delta, total uint64, at time.Duration) *Envelope {
+	return &Envelope{Origin: proto.String(origin), EventType: eventType(EventTypeCounterEvent), Timestamp: proto.Int64(storeStart.Add(at).UnixNano()),
+		Deployment: proto.String("cf"), Job: proto.String(job), Index: proto.String(index), Ip: proto.String("10.0.0." + index),
+		CounterEvent: &CounterEvent{Name: proto.String(name), Delta: proto.Uint64(delta), Total: proto.Uint64(total)}}
+}
+
+// ingressDropped doppler dropped counter envelope tagged with the ingress direction
+func ingressDropped(index string, delta, total uint64, at time.Duration) *Envelope {
+	e := counterEnvelope(dopplerSID, dopplerJob, index, droppedCounter, delta, total, at)
+	e.Tags = map[string]string{"direction": "ingress"}
+	return e
+}
+
+func TestEnvelopeStoreAggregate(t *testing.T) {
+	st := newEnvelopeStore()
+	for _, e := range []*Envelope{
+		gaugeEnvelope(dopplerSID, dopplerJob, "0", subscriptionsGauge, 4, 0),
+		gaugeEnvelope(dopplerSID, dopplerJob, "0", subscriptionsGauge, 6, time.Minute),
+		gaugeEnvelope(dopplerSID, dopplerJob, "1", subscriptionsGauge, 2, 0),
+		gaugeEnvelope(dopplerSID, "doppler-z2", "0", subscriptionsGauge, 10, 0),
+		counterEnvelope(dopplerSID, dopplerJob, "0", ingressCounter, 600, 600, 0),
+		counterEnvelope(dopplerSID, dopplerJob, "0", ingressCounter, 600, 1200, time.Minute),
+		counterEnvelope(dopplerSID, dopplerJob, "1", ingressCounter, 1200, 5000, time.Minute),
+	} {
+		st.Add(e)
+	}
+	onDoppler := map[string]string{"job": dopplerJob}
+	tests := []struct {
+		aggregation string
+		metric      string
+		matchers    map[string]string
+		by          string
+		want        map[string]float64
+		wantErr     bool
+	}{
+		{aggregation: "sum", metric: subscriptionsGauge, matchers: onDoppler, want: map[string]float64{"": 8}},
+		{aggregation: "avg", metric: subscriptionsGauge, matchers: onDoppler, want: map[string]float64{"": 4}},
+		{aggregation: "max", metric: subscriptionsGauge, want: map[string]float64{"": 10}},
+		{aggregation: "min", metric: subscriptionsGauge, want: map[string]float64{"": 2}},
+		{aggregation: "count", metric: subscriptionsGauge, want: map[string]float64{"": 3}},
+		{aggregation: "avg_over_time", metric: subscriptionsGauge, matchers: onDoppler, want: map[string]float64{"": 4}},
+		{aggregation: "sum", metric: subscriptionsGauge, by: "job", want: map[string]float64{dopplerJob: 8, "doppler-z2": 10}},
+		{aggregation: "sum", metric: subscriptionsGauge, by: "job,index", want: map[string]float64{"doppler/0": 6, "doppler/1": 2, "doppler-z2/0": 10}},
+		{aggregation: "sum_rate", metric: ingressCounter, want: map[string]float64{"": 40}},
+		{aggregation: "max_rate", metric: ingressCounter, by: "index", want: map[string]float64{"0": 20, "1": 20}},
+		{aggregation: "sum", metric: ingressCounter, want: map[string]float64{"": 6200}},
+		{aggregation: "avg_rate", metric: subscriptionsGauge, matchers: map[string]string{"index": "0", "job": dopplerJob}, want: map[string]float64{"": 2.0 / 60}},
+		{aggregation: "sum", metric: "missing", want: map[string]float64{}},
+		{aggregation: "quantile", metric: subscriptionsGauge, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.aggregation+" "+tt.metric+" "+tt.by, func(t *testing.T) {
+			got, err := st.aggregate(tt.aggregation, tt.metric, dopplerSID, tt.matchers, tt.by)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v got %v", tt.wantErr, err)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %v got %v", tt.want, got)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("expected %v got %v", tt.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestEnvelopeStoreMetrics(t *testing.T) {
+	catalog, err := LoadCatalog("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		envelopes []*Envelope
+		check     func(t *testing.T, m Metrics)
+	}{
+		{
+			name: "cpu and memory are gauge levels",
+			envelopes: []*Envelope{
+				gaugeEnvelope(boshSystemMetricsSID, dopplerJob, "0", "system.cpu.user", 95, 0),
+				gaugeEnvelope(boshSystemMetricsSID, dopplerJob, "0", "system.cpu.user", 95, time.Minute),
+				gaugeEnvelope(boshSystemMetricsSID, dopplerJob, "1", "system.cpu.user", 15, 0),
+				gaugeEnvelope(boshSystemMetricsSID, dopplerJob, "1", "system.cpu.user", 15, time.Minute),
+				gaugeEnvelope(boshSystemMetricsSID, dopplerJob, "0", "system.mem.percent", 60, 0),
+				gaugeEnvelope(boshSystemMetricsSID, dopplerJob, "1", "system.mem.percent", 40, time.Minute),
+			},
+			check: func(t *testing.T, m Metrics) {
+				if len(m.System) != 1 || m.System[0].Name != dopplerJob {
+					t.Fatalf("expected the doppler job got %+v", m.System)
+				}
+				j := m.System[0]
+				if j.Count != 2 || j.CPUUser != 55 || j.Memory != 50 {
+					t.Errorf("expected 2 instances at 55%% cpu and 50%% memory got %d, %v and %v", j.Count, j.CPUUser, j.Memory)
+				}
+				if j.CPUUserSpread.Max != 95 || j.CPUUserSpread.Worst != "0/10.0.0.0" || !j.CPUUserSpread.Imbalanced() {
+					t.Errorf("expected instance 0 to be a hot spot got %+v", j.CPUUserSpread)
+				}
+				if m.Doppler.System.CPUUser != 55 {
+					t.Errorf("expected doppler panel cpu user 55 got %v", m.Doppler.System.CPUUser)
+				}
+			},
+		},
+		{
+			name: "doppler ingress and capacity",
+			envelopes: []*Envelope{
+				gaugeEnvelope(boshSystemMetricsSID, dopplerJob, "0", "system.cpu.user", 10, 0),
+				gaugeEnvelope(boshSystemMetricsSID, dopplerJob, "1", "system.cpu.user", 10, 0),
+				counterEnvelope(dopplerSID, dopplerJob, "0", ingressCounter, 3000, 3000, time.Minute),
+				counterEnvelope(dopplerSID, dopplerJob, "1", ingressCounter, 1800, 1800, time.Minute),
+				counterEnvelope(dopplerSID, dopplerJob, "1", droppedCounter, 60, 60, time.Minute),
+			},
+			check: func(t *testing.T, m Metrics) {
+				if m.Doppler.Ingress != 80 || m.Doppler.Dropped != 1 {
+					t.Errorf("expected ingress 80/s and 1/s dropped got %v and %v", m.Doppler.Ingress, m.Doppler.Dropped)
+				}
+				if m.Doppler.MessageRateCapacity != 40 {
+					t.Errorf("expected capacity 40 got %v", m.Doppler.MessageRateCapacity)
+				}
+				if len(m.DopplerInstance) != 2 || m.DopplerInstance[0].Ingress != 50 {
+					t.Errorf("expected two doppler instances got %+v", m.DopplerInstance)
+				}
+			},
+		},
+		{
+			name: "doppler ingress dropped",
+			envelopes: []*Envelope{
+				ingressDropped("0", 30, 500, 0),
+				ingressDropped("0", 60, 560, time.Minute),
+				ingressDropped("1", 600, 900, time.Minute),
+			},
+			check: func(t *testing.T, m Metrics) {
+				// the panel is the largest dropped total like the live query
+				if m.Doppler.IngressDropped != 900 {
+					t.Errorf("expected the largest ingress dropped total 900 got %v", m.Doppler.IngressDropped)
+				}
+				// instances show the rate like the live per instance query
+				if len(m.DopplerInstance) != 2 || m.DopplerInstance[0].IngressDropped != 1.5 || m.DopplerInstance[1].IngressDropped != 10 {
+					t.Errorf("expected ingress dropped rates 1.5/s and 10/s got %+v", m.DopplerInstance)
+				}
+			},
+		},
+		{
+			name: "agents",
+			envelopes: []*Envelope{
+				counterEnvelope(metronSID, "diego-cell", "0", ingressCounter, 600, 600, 0),
+				counterEnvelope(metronSID, "diego-cell", "0", droppedCounter, 120, 120, time.Minute),
+				counterEnvelope(metronSID, "router", "1", ingressCounter, 60, 60, time.Minute),
+			},
+			check: func(t *testing.T, m Metrics) {
+				if m.Metron.Ingress != 11 || m.Metron.Dropped != 2 {
+					t.Errorf("expected metron ingress 11/s and 2/s dropped got %v and %v", m.Metron.Ingress, m.Metron.Dropped)
+				}
+				if len(m.MetronInstance) != 2 || m.MetronInstance[0].Name != "cf/diego-cell/0" || m.MetronInstance[0].Dropped != 2 {
+					t.Errorf("expected the diego cell to be listed first got %+v", m.MetronInstance)
+				}
+				if m.Doppler.MessageRateCapacity != 0 {
+					t.Errorf("expected no capacity without dopplers got %v", m.Doppler.MessageRateCapacity)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := newEnvelopeStore()
+			for _, e := range tt.envelopes {
+				st.Add(e)
+			}
+			m, errs := st.Metrics(queryProfiles["syslog-agent"], catalog, "index", nil)
+			if len(errs) > 0 {
+				t.Fatalf("unexpected errors %v", errs)
+			}
+			tt.check(t, m)
+		})
+	}
+}
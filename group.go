@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// groupedPanels catalog panels that are split into one row per group
+var groupedPanels = map[string]bool{
+	"doppler":        true,
+	"metron":         true,
+	"rlp":            true,
+	"drain":          true,
+	"syslog_adapter": true,
+}
+
+// GroupMetrics metrics of the grouped panels for a single value of the group label
+type GroupMetrics struct {
+	Name   string  `json:"name"`
+	Metric Metrics `json:"metrics"`
+}
+
+// groupLabels labels that can be used with --group-by
+func groupLabels() []string {
+	labels := make([]string, 0)
+	t := reflect.TypeOf(CacheMetric{})
+	for i := 0; i < t.NumField(); i++ {
+		labels = append(labels, strings.Split(t.Field(i).Tag.Get("json"), ",")[0])
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+func validGroupLabel(label string) error {
+	if label == "" {
+		return nil
+	}
+	labels := groupLabels()
+	for i := range labels {
+		if labels[i] == label {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid group label \"%s\" expected one of %s", label, strings.Join(labels, ", "))
+}
+
+// collectGroups schedules a grouped query for every enabled entry of the grouped panels.
+// Results are stored in groups keyed by the value of label
+func (lc *LCC) collectGroups(p *queryPool, c Catalog, label, offset, duration string, groups map[string]*GroupMetrics) {
+	for _, e := range c {
+		set, ok := catalogBindings[e.Key()]
+		if !ok || !groupedPanels[e.Panel] || !e.Grouped() || !e.Enabled(lc.Profile) {
+			continue
+		}
+		q := e.Expand(lc.Profile, offset, duration, label)
+		p.Go(q, func(ctx context.Context) error {
+			result, err := lc.GetQueryResult(ctx, q)
+			samples := result.GetVector().GetSamples()
+			p.Do(func() {
+				for _, s := range samples {
+					name := s.GetMetric()[label]
+					g, ok := groups[name]
+					if !ok {
+						g = &GroupMetrics{Name: name}
+						groups[name] = g
+					}
+					set(&g.Metric, s.GetPoint().GetValue())
+				}
+			})
+			return err
+		})
+	}
+}
+
+// groupList flattens the group map into a slice sorted by name
+func groupList(groups map[string]*GroupMetrics) []GroupMetrics {
+	l := make([]GroupMetrics, 0, len(groups))
+	for _, g := range groups {
+		l = append(l, *g)
+	}
+	sort.SliceStable(l, func(i, j int) bool { return l[i].Name < l[j].Name })
+	return l
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"code.cloudfoundry.org/log-cache/pkg/rpc/logcache_v1"
+)
+
+func TestValidGroupLabel(t *testing.T) {
+	tests := []struct {
+		label   string
+		wantErr bool
+	}{
+		{label: ""},
+		{label: "deployment"},
+		{label: "az"},
+		{label: "instance-id"},
+		{label: "placement_tag", wantErr: true},
+		{label: "deployment,az", wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := validGroupLabel(tt.label); (err != nil) != tt.wantErr {
+			t.Errorf("validGroupLabel(%q) error = %v, wantErr %v", tt.label, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCollectGroups(t *testing.T) {
+	builtin, err := LoadCatalog("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := queryProfiles["syslog-agent"]
+	c := make(Catalog, 0)
+	results := make(map[string][]*logcache_v1.PromQL_Sample)
+	for _, e := range builtin {
+		switch e.Key() {
+		case "doppler.ingress", "doppler.dropped", "metron.ingress":
+			results[e.Expand(p, "2m", "5m", "deployment")] = []*logcache_v1.PromQL_Sample{
+				promSample(1000, "deployment", "cf"),
+				promSample(4000, "deployment", "iso-seg-2"),
+			}
+		case "doppler.ingress_dropped", "tc.firehoses":
+			// not grouped, only the grouped panels and {by} templates are split
+		default:
+			continue
+		}
+		c = append(c, e)
+	}
+
+	groups := make(map[string]*GroupMetrics)
+	errs := runCollector(t, results, func(lc *LCC, pool *queryPool) {
+		lc.Profile = p
+		lc.collectGroups(pool, c, "deployment", "2m", "5m", groups)
+	})
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+	l := groupList(groups)
+	if len(l) != 2 || l[0].Name != "cf" || l[1].Name != "iso-seg-2" {
+		t.Fatalf("expected the cf and iso-seg-2 groups got %+v", l)
+	}
+	if d := l[1].Metric.Doppler; d.Ingress != 4000 || d.Dropped != 4000 || d.IngressDropped != 0 {
+		t.Errorf("unexpected iso-seg-2 doppler metrics %+v", d)
+	}
+	if l[0].Metric.Metron.Ingress != 1000 || l[0].Metric.TC.Firehoses != 0 {
+		t.Errorf("unexpected cf metrics %+v", l[0].Metric)
+	}
+
+	stats := groupStats(&Snapshot{Profile: "syslog-agent", Metric: Metrics{GroupBy: "deployment", Groups: l}})
+	if !strings.Contains(stats, "Grouped by deployment") {
+		t.Errorf("expected the group header in %q", stats)
+	}
+	for _, g := range []string{"cf", "iso-seg-2"} {
+		if !strings.Contains(stats, "\n"+g) {
+			t.Errorf("expected a row for %s in %q", g, stats)
+		}
+	}
+	if strings.Contains(stats, "RLP") {
+		t.Error("expected groups without rlp traffic to have no rlp row")
+	}
+	if groupStats(&Snapshot{}) != "" {
+		t.Error("expected no grouped panel without --group-by")
+	}
+}
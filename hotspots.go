@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// imbalanceRatio a job is imbalanced when its busiest instance is at least this
+// multiple of the job average
+const imbalanceRatio = 1.5
+
+// instanceSample value reported by a single instance of a job
+type instanceSample struct {
+	Index string
+	IP    string
+	Value float64
+}
+
+// Spread distribution of a system metric across the instances of a job
+type Spread struct {
+	Mean   float64 `json:"mean"`
+	Max    float64 `json:"max"`
+	Min    float64 `json:"min"`
+	StdDev float64 `json:"std_dev"`
+	Worst  string  `json:"worst"` // index/ip of the instance reporting Max
+}
+
+// Imbalanced true when one instance is running well above the rest of the job
+func (s Spread) Imbalanced() bool {
+	return s.Mean > 0 && s.Max >= s.Mean*imbalanceRatio
+}
+
+// Indicator marker shown next to the job averages
+func (s Spread) Indicator() string {
+	if s.Imbalanced() {
+		return "!"
+	}
+	return ""
+}
+
+// collectSystemInstances schedules per instance cpu and memory queries so one pegged
+// vm is not hidden by the job average
+func (lc *LCC) collectSystemInstances(p *queryPool, jobs map[string]*InstanceMetrics) {
+	get := func(name string) *InstanceMetrics {
+		j, ok := jobs[name]
+		if !ok {
+			j = &InstanceMetrics{Name: name}
+			jobs[name] = j
+		}
+		return j
+	}
+	sample := func(labels map[string]string, v float64) instanceSample {
+		return instanceSample{Index: labels["index"], IP: labels["ip"], Value: v}
+	}
+	lc.groupedBy(p, cpuUserGauge, boshSystemMetricsSID, "", querySystemInstanceAvgBy, func(l map[string]string, v float64) {
+		j := get(l["job"])
+		j.cpuSamples = append(j.cpuSamples, sample(l, v))
+	})
+	lc.groupedBy(p, memoryPercentGauge, boshSystemMetricsSID, "", querySystemInstanceAvgBy, func(l map[string]string, v float64) {
+		j := get(l["job"])
+		j.memorySamples = append(j.memorySamples, sample(l, v))
+	})
+}
+
+// spread computes the distribution of samples and names the instance reporting the max
+func spread(samples []instanceSample) Spread {
+	if len(samples) == 0 {
+		return Spread{}
+	}
+	// keep the worst instance stable when several report the same value
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].Index < samples[j].Index })
+
+	s := Spread{Max: samples[0].Value, Min: samples[0].Value}
+	var total float64
+	for _, v := range samples {
+		total += v.Value
+		if v.Value > s.Max {
+			s.Max = v.Value
+		}
+		if v.Value < s.Min {
+			s.Min = v.Value
+		}
+	}
+	s.Mean = total / float64(len(samples))
+	var variance float64
+	for _, v := range samples {
+		if v.Value == s.Max && s.Worst == "" {
+			s.Worst = fmt.Sprintf("%s/%s", v.Index, v.IP)
+		}
+		variance += (v.Value - s.Mean) * (v.Value - s.Mean)
+	}
+	s.StdDev = math.Sqrt(variance / float64(len(samples)))
+	return s
+}
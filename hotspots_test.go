@@ -0,0 +1,76 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSpread(t *testing.T) {
+	tests := []struct {
+		name       string
+		samples    []instanceSample
+		want       Spread
+		imbalanced bool
+	}{
+		{
+			name: "no samples",
+			want: Spread{},
+		},
+		{
+			name:    "single instance",
+			samples: []instanceSample{{Index: "0", IP: "10.0.0.1", Value: 95}},
+			want:    Spread{Mean: 95, Max: 95, Min: 95, Worst: "0/10.0.0.1"},
+		},
+		{
+			name: "balanced",
+			samples: []instanceSample{
+				{Index: "0", IP: "10.0.0.1", Value: 40},
+				{Index: "1", IP: "10.0.0.2", Value: 50},
+				{Index: "2", IP: "10.0.0.3", Value: 60},
+			},
+			want: Spread{Mean: 50, Max: 60, Min: 40, StdDev: math.Sqrt(200.0 / 3), Worst: "2/10.0.0.3"},
+		},
+		{
+			name: "one pegged vm",
+			samples: []instanceSample{
+				{Index: "1", IP: "10.0.0.2", Value: 95},
+				{Index: "0", IP: "10.0.0.1", Value: 10},
+				{Index: "2", IP: "10.0.0.3", Value: 10},
+				{Index: "3", IP: "10.0.0.4", Value: 10},
+			},
+			want:       Spread{Mean: 31.25, Max: 95, Min: 10, StdDev: math.Sqrt((63.75*63.75 + 3*21.25*21.25) / 4), Worst: "1/10.0.0.2"},
+			imbalanced: true,
+		},
+		{
+			name: "ties pick the lowest index",
+			samples: []instanceSample{
+				{Index: "2", IP: "10.0.0.3", Value: 80},
+				{Index: "1", IP: "10.0.0.2", Value: 80},
+			},
+			want: Spread{Mean: 80, Max: 80, Min: 80, Worst: "1/10.0.0.2"},
+		},
+		{
+			name: "idle job",
+			samples: []instanceSample{
+				{Index: "0", IP: "10.0.0.1", Value: 0},
+				{Index: "1", IP: "10.0.0.2", Value: 0},
+			},
+			want: Spread{Worst: "0/10.0.0.1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := spread(tt.samples)
+			if got.Mean != tt.want.Mean || got.Max != tt.want.Max || got.Min != tt.want.Min || got.Worst != tt.want.Worst ||
+				math.Abs(got.StdDev-tt.want.StdDev) > 1e-9 {
+				t.Errorf("expected %+v got %+v", tt.want, got)
+			}
+			if got.Imbalanced() != tt.imbalanced {
+				t.Errorf("expected imbalanced %v got %v", tt.imbalanced, got.Imbalanced())
+			}
+			if (got.Indicator() == "!") != tt.imbalanced {
+				t.Errorf("unexpected indicator \"%s\"", got.Indicator())
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+var importUsage = `
+
+cf firehose-analyzer import <options> <capture>...
+
+Builds the report from firehose captures instead of log-cache.  Captures are either
+the text printed by cf nozzle, one envelope per line, or raw sonde-go envelopes
+written as a stream of varint length prefixed protobuf messages.  Short
+"GAUGE name:value" and "COUNTER name:total" lines are attributed to --source,
+--job and --index.
+
+Options
+--raw          - captures hold raw protobuf envelopes instead of text
+--span <duration> - capture length used for rates when the capture has no
+                 timestamps, required for captures of short lines
+--source <id>  - source id of short GAUGE and COUNTER lines
+--job <name>   - job of short GAUGE and COUNTER lines
+--index <id>   - index of short GAUGE and COUNTER lines
+--profile <name> - legacy, syslog-agent or forwarder-agent, default is auto which
+                 detects the platform from the captured source ids
+-l, -s, -n, -k, -r, --catalog, --jobs, --format - same as the live analyzer`
+
+// captureImporter reads captures into an envelope store
+type captureImporter struct {
+	store  *envelopeStore
+	source string
+	job    string
+	index  string
+	totals map[string]uint64 // last total of short COUNTER lines
+	errors []error
+}
+
+func newCaptureImporter(store *envelopeStore, source, job, index string) *captureImporter {
+	return &captureImporter{store: store, source: source, job: job, index: index, totals: make(map[string]uint64)}
+}
+
+// shortLine parses "GAUGE name:value" and "COUNTER name:total" lines
+func (ci *captureImporter) shortLine(kind, metric string) (*Envelope, error) {
+	if ci.source == "" {
+		return nil, fmt.Errorf("%s lines need --source", kind)
+	}
+	i := strings.LastIndex(metric, ":")
+	if i < 0 {
+		return nil, fmt.Errorf("expected name:value got \"%s\"", metric)
+	}
+	name := metric[:i]
+	value, err := strconv.ParseFloat(metric[i+1:], 64)
+	if err != nil {
+		return nil, err
+	}
+	e := &Envelope{Origin: proto.String(ci.source), Tags: map[string]string{"source_id": ci.source}, Job: proto.String(ci.job), Index: proto.String(ci.index)}
+	if kind == "GAUGE" {
+		e.EventType = eventType(EventTypeValueMetric)
+		e.ValueMetric = &ValueMetric{Name: proto.String(name), Value: proto.Float64(value), Unit: proto.String("")}
+		return e, nil
+	}
+	// the delta is the change from the previous total of the same counter
+	total := uint64(value)
+	var delta uint64
+	if prev, ok := ci.totals[name]; ok && total >= prev {
+		delta = total - prev
+	}
+	ci.totals[name] = total
+	e.EventType = eventType(EventTypeCounterEvent)
+	e.CounterEvent = &CounterEvent{Name: proto.String(name), Delta: proto.Uint64(delta), Total: proto.Uint64(total)}
+	return e, nil
+}
+
+func eventType(t EventType) *EventType {
+	return &t
+}
+
+// line parses a single line of a text capture
+func (ci *captureImporter) line(l string) error {
+	l = strings.TrimSpace(ansiEscape.ReplaceAllString(l, ""))
+	if l == "" || strings.HasPrefix(l, "#") {
+		return nil
+	}
+	for _, kind := range []string{"GAUGE", "COUNTER"} {
+		if strings.HasPrefix(l, kind+" ") {
+			e, err := ci.shortLine(kind, strings.TrimSpace(l[len(kind):]))
+			if err != nil {
+				return err
+			}
+			ci.store.Add(e)
+			return nil
+		}
+	}
+	if !strings.Contains(l, "eventType:ValueMetric") && !strings.Contains(l, "eventType:CounterEvent") {
+		// log messages, http and container events
+		return nil
+	}
+	var e Envelope
+	if err := proto.UnmarshalText(l, &e); err != nil {
+		return err
+	}
+	ci.store.Add(&e)
+	return nil
+}
+
+// readText imports a cf nozzle text capture
+func (ci *captureImporter) readText(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	n := 0
+	for scanner.Scan() {
+		n++
+		if err := ci.line(scanner.Text()); err != nil {
+			ci.errors = append(ci.errors, fmt.Errorf("%s:%d: %s", path, n, err))
+		}
+	}
+	return scanner.Err()
+}
+
+// readRaw imports a stream of varint length prefixed envelopes
+func (ci *captureImporter) readRaw(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	for n := 1; len(b) > 0; n++ {
+		size, i := binary.Uvarint(b)
+		if i <= 0 || uint64(len(b)-i) < size {
+			return fmt.Errorf("%s: envelope %d is truncated", path, n)
+		}
+		var e Envelope
+		if err := proto.Unmarshal(b[i:i+int(size)], &e); err != nil {
+			ci.errors = append(ci.errors, fmt.Errorf("%s: envelope %d: %s", path, n, err))
+		} else {
+			ci.store.Add(&e)
+		}
+		b = b[i+int(size):]
+	}
+	return nil
+}
+
+// captureProfile selects the profile named name or detects it from the captured
+// source ids when name is auto
+func captureProfile(store *envelopeStore, name string) (QueryProfile, string, error) {
+	if name != autoProfile {
+		p, ok := queryProfiles[name]
+		if !ok {
+			return p, "", fmt.Errorf("unknown profile \"%s\" expected one of %s", name, strings.Join(profileNames(), ", "))
+		}
+		return p, "selected with --profile", nil
+	}
+	sources := store.Sources()
+	p, reason, ok := profileFromSources(func(sid string) bool { return sources[sid] })
+	if !ok {
+		return p, "", fmt.Errorf("could not detect profile from the captured source ids, use --profile %s", strings.Join(profileNames(), ", "))
+	}
+	return p, reason, nil
+}
+
+// storeSnapshot builds a snapshot from the envelopes in the store
+func storeSnapshot(store *envelopeStore, p QueryProfile, reason string, catalog Catalog, errs []error) *Snapshot {
+	s := &Snapshot{Start: store.first, Stop: store.last, Offset: "0s", Duration: store.Span().String(), Profile: p.Name, ProfileReason: reason, NoAppRates: true}
+	if s.Stop.IsZero() {
+		s.Start, s.Stop = time.Now(), time.Now()
+	}
+	m, merrs := store.Metrics(p, catalog, *instanceLabel, parseJobFilter(*jobFilter))
+	s.Metric = m
+	s.CollectionErrors = append(errs, merrs...)
+	return s
+}
+
+func startImport(args []string) {
+	reporting = true
+	fs := flag.NewFlagSet("firehose-import-args", flag.ContinueOnError)
+	addAnalyzerFlags(fs)
+	raw := fs.Bool("raw", false, "Specify captures hold raw protobuf envelopes")
+	span := fs.Duration("span", 0, "Specify capture length")
+	source := fs.String("source", "", "Specify source id of short lines")
+	job := fs.String("job", "", "Specify job of short lines")
+	index := fs.String("index", "", "Specify index of short lines")
+	fs.Usage = func() { fmt.Println(importUsage) }
+	parseFlags(fs, args)
+	if fs.NArg() == 0 {
+		fmt.Println(importUsage)
+		os.Exit(setupExitCode())
+	}
+	if err := validateAnalyzerFlags(); err != nil {
+		fmt.Println(err)
+		os.Exit(setupExitCode())
+	}
+	logger.SetOutput(statusOutput())
+	catalog, err := LoadCatalog(*catalogFile)
+	if err != nil {
+		fatalln(err)
+	}
+
+	store := newEnvelopeStore()
+	store.span = *span
+	ci := newCaptureImporter(store, *source, *job, *index)
+	for _, path := range fs.Args() {
+		if *raw {
+			err = ci.readRaw(path)
+		} else {
+			err = ci.readText(path)
+		}
+		if err != nil {
+			fatalf("Could not read capture: %s\n", err)
+		}
+	}
+	if store.Span() <= 0 {
+		fmt.Println("the capture has no timestamps so rates can not be computed, use --span")
+		os.Exit(setupExitCode())
+	}
+	p, reason, err := captureProfile(store, *profile)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(setupExitCode())
+	}
+	os.Exit(reportSnapshot(storeSnapshot(store, p, reason, catalog, ci.errors)))
+}
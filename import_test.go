@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+func TestCaptureImporterLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		wantErr bool
+		metric  string
+		source  string
+		value   float64
+	}{
+		{
+			name:   "value metric",
+			line:   `origin:"doppler" eventType:ValueMetric timestamp:1580000000000000000 deployment:"cf" job:"doppler" index:"0" ip:"10.0.0.1" valueMetric:<name:"subscriptions" value:12 unit:"count" >`,
+			metric: subscriptionsGauge, source: dopplerSID, value: 12,
+		},
+		{
+			name:   "counter event",
+			line:   `origin:"doppler" eventType:CounterEvent timestamp:1580000000000000000 deployment:"cf" job:"doppler" index:"0" ip:"10.0.0.1" counterEvent:<name:"ingress" delta:40 total:1000 >`,
+			metric: ingressCounter, source: dopplerSID, value: 1000,
+		},
+		{
+			name:   "loggregator origin alias",
+			line:   `origin:"loggregator.trafficcontroller" eventType:CounterEvent timestamp:1580000000000000000 counterEvent:<name:"egress" delta:7 total:7 >`,
+			metric: egressCounter, source: trafficControllerSID, value: 7,
+		},
+		{
+			name:   "source id tag",
+			line:   `origin:"loggregator_forwarder_agent" eventType:CounterEvent timestamp:1580000000000000000 tags:<key:"source_id" value:"forwarder_agent" > counterEvent:<name:"dropped" delta:3 total:3 >`,
+			metric: droppedCounter, source: forwarderAgentSID, value: 3,
+		},
+		{
+			name:   "colored output",
+			line:   "\x1b[32morigin:\"doppler\" eventType:ValueMetric valueMetric:<name:\"dump_sinks\" value:2 unit:\"count\" >\x1b[0m",
+			metric: dumpSinksGauge, source: dopplerSID, value: 2,
+		},
+		{name: "blank", line: "   "},
+		{name: "comment", line: "# cf nozzle capture"},
+		{name: "log message", line: `origin:"rep" eventType:LogMessage logMessage:<message:"hello" message_type:OUT timestamp:1 >`},
+		{name: "malformed", line: `origin:"doppler" eventType:CounterEvent counterEvent:<name:"ingress" delta:oops >`, wantErr: true},
+		{name: "short line without source", line: "GAUGE drains:1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newEnvelopeStore()
+			ci := newCaptureImporter(store, "", "", "")
+			err := ci.line(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v got %v", tt.wantErr, err)
+			}
+			if tt.metric == "" {
+				if len(store.series) != 0 {
+					t.Errorf("expected the line to be skipped got %d series", len(store.series))
+				}
+				return
+			}
+			v, err := store.aggregate("sum", tt.metric, tt.source, nil, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v[""] != tt.value {
+				t.Errorf("expected %s from %s to be %v got %v", tt.metric, tt.source, tt.value, v[""])
+			}
+		})
+	}
+}
+
+func TestCaptureImporterShortLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []string
+		metric  string
+		rate    bool
+		want    float64
+		wantErr bool
+	}{
+		{name: "gauge keeps the last value", lines: []string{"GAUGE drains:1.000000", "GAUGE drains:4.000000"}, metric: drainsGauge, want: 4},
+		{name: "counter sums the change in totals", lines: []string{"COUNTER ingress:100", "COUNTER ingress:160", "COUNTER ingress:400"}, metric: ingressCounter, rate: true, want: 300.0 / 60},
+		{name: "counter reset", lines: []string{"COUNTER ingress:100", "COUNTER ingress:40", "COUNTER ingress:100"}, metric: ingressCounter, rate: true, want: 60.0 / 60},
+		{name: "name with colons", lines: []string{"GAUGE a:b:2"}, metric: "a:b", want: 2},
+		{name: "missing value", lines: []string{"GAUGE drains"}, wantErr: true},
+		{name: "invalid value", lines: []string{"COUNTER ingress:lots"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newEnvelopeStore()
+			store.span = time.Minute
+			ci := newCaptureImporter(store, syslogAgentSID, "diego-cell", "3")
+			for _, l := range tt.lines {
+				if err := ci.line(l); err != nil {
+					if !tt.wantErr {
+						t.Fatalf("%s: %s", l, err)
+					}
+					return
+				}
+			}
+			if tt.wantErr {
+				t.Fatal("expected an error")
+			}
+			aggregation := "sum"
+			if tt.rate {
+				aggregation = "sum_rate"
+			}
+			v, err := store.aggregate(aggregation, tt.metric, syslogAgentSID, map[string]string{"job": "diego-cell", "index": "3"}, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v[""] != tt.want {
+				t.Errorf("expected %v got %v", tt.want, v[""])
+			}
+		})
+	}
+}
+
+// rawCapture encodes envelopes as a stream of varint length prefixed messages
+func rawCapture(t *testing.T, envelopes ...*Envelope) []byte {
+	var b []byte
+	for _, e := range envelopes {
+		msg, err := proto.Marshal(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := make([]byte, binary.MaxVarintLen64)
+		b = append(b, size[:binary.PutUvarint(size, uint64(len(msg)))]...)
+		b = append(b, msg...)
+	}
+	return b
+}
+
+func TestCaptureImporterReadRaw(t *testing.T) {
+	counter := func(sid string, delta uint64, ts int64) *Envelope {
+		return &Envelope{Origin: proto.String(sid), EventType: eventType(EventTypeCounterEvent), Timestamp: proto.Int64(ts),
+			Job: proto.String(sid), Index: proto.String("0"),
+			CounterEvent: &CounterEvent{Name: proto.String(ingressCounter), Delta: proto.Uint64(delta), Total: proto.Uint64(delta)}}
+	}
+	valid := rawCapture(t, counter(dopplerSID, 100, 0), counter(dopplerSID, 200, int64(10*time.Second)))
+	tests := []struct {
+		name       string
+		capture    []byte
+		wantErr    bool
+		decodeErrs int
+		want       float64
+	}{
+		{name: "envelopes", capture: valid, want: 30},
+		{name: "empty", capture: []byte{}},
+		{name: "truncated", capture: valid[:len(valid)-3], wantErr: true},
+		{name: "undecodable envelope", capture: append([]byte{2, 0xff, 0xff}, valid...), decodeErrs: 1, want: 30},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "capture.bin")
+			if err := ioutil.WriteFile(path, tt.capture, 0644); err != nil {
+				t.Fatal(err)
+			}
+			store := newEnvelopeStore()
+			ci := newCaptureImporter(store, "", "", "")
+			err := ci.readRaw(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v got %v", tt.wantErr, err)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(ci.errors) != tt.decodeErrs {
+				t.Errorf("expected %d decode errors got %v", tt.decodeErrs, ci.errors)
+			}
+			v, err := store.aggregate("sum_rate", ingressCounter, dopplerSID, nil, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v[""] != tt.want {
+				t.Errorf("expected ingress %v/s got %v", tt.want, v[""])
+			}
+		})
+	}
+}
+
+func TestEventTypeEnumRegistration(t *testing.T) {
+	// sonde-go/events registers this name, vendoring it must not panic
+	if proto.EnumValueMap("events.Envelope_EventType") != nil {
+		t.Errorf("events.Envelope_EventType is registered by the analyzer")
+	}
+	if got := proto.EnumValueMap(eventTypeEnum)["CounterEvent"]; got != int32(EventTypeCounterEvent) {
+		t.Errorf("expected CounterEvent to be %d got %d", EventTypeCounterEvent, got)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// lcMemoryPressureWarn fraction of system memory in use before a node is highlighted
+const lcMemoryPressureWarn = 0.8
+
+// LogCacheMetrics log cache node metrics
+type LogCacheMetrics struct {
+	Name            string  `json:"name"`
+	AvailableMemory float64 `json:"available_memory"` // bytes
+	TotalMemory     float64 `json:"total_memory"`     // bytes
+	Expired         float64 `json:"expired"`          // envelopes/s
+	CachePeriod     float64 `json:"cache_period"`     // milliseconds
+	NozzleErrors    float64 `json:"nozzle_errors"`    // errors/s
+}
+
+// MemoryPressure fraction of system memory in use on the node
+func (l LogCacheMetrics) MemoryPressure() float64 {
+	if l.TotalMemory == 0 {
+		return 0
+	}
+	return 1 - l.AvailableMemory/l.TotalMemory
+}
+
+// Period effective cache period of the node
+func (l LogCacheMetrics) Period() time.Duration {
+	return time.Duration(l.CachePeriod) * time.Millisecond
+}
+
+// Evicting true when the node is expiring envelopes before the expected retention
+func (l LogCacheMetrics) Evicting(retention time.Duration) bool {
+	return l.CachePeriod > 0 && l.Period() < retention
+}
+
+// collectLogCacheNodes schedules the per node log cache queries.  Results are stored
+// in nodes keyed by the value of label
+func (lc *LCC) collectLogCacheNodes(p *queryPool, label string, nodes map[string]*LogCacheMetrics) {
+	get := func(name string) *LogCacheMetrics {
+		n, ok := nodes[name]
+		if !ok {
+			n = &LogCacheMetrics{Name: name}
+			nodes[name] = n
+		}
+		return n
+	}
+	lc.grouped(p, label, lcSystemMemGauge, logCacheSID, "", queryNameSumBy, func(n string, v float64) { get(n).AvailableMemory = v })
+	lc.grouped(p, label, lcTotalMemGauge, logCacheSID, "", queryNameSumBy, func(n string, v float64) { get(n).TotalMemory = v })
+	lc.grouped(p, label, lcExpiredCounter, logCacheSID, "", queryNameRateBy, func(n string, v float64) { get(n).Expired = v })
+	lc.grouped(p, label, lcCachePeriodGauge, logCacheSID, "", queryNameMinBy, func(n string, v float64) { get(n).CachePeriod = v })
+	lc.grouped(p, label, lcnErrCounter, logCacheNozzleSID, "", queryNameRateBy, func(n string, v float64) { get(n).NozzleErrors = v })
+}
+
+// logCacheNodeList flattens the node map into a slice ordered by cache period so the
+// nodes holding the least history come first
+func logCacheNodeList(nodes map[string]*LogCacheMetrics) []LogCacheMetrics {
+	l := make([]LogCacheMetrics, 0, len(nodes))
+	for _, n := range nodes {
+		l = append(l, *n)
+	}
+	sort.SliceStable(l, func(i, j int) bool {
+		if l[i].CachePeriod == l[j].CachePeriod {
+			return l[i].Name < l[j].Name
+		}
+		return l[i].CachePeriod < l[j].CachePeriod
+	})
+	return l
+}
+
+// formatBytes human readable byte count
+func formatBytes(b float64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	i := 0
+	for b >= 1024 && i < len(units)-1 {
+		b /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f%s", b, units[i])
+}
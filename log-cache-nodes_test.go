@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"code.cloudfoundry.org/log-cache/pkg/rpc/logcache_v1"
+)
+
+func TestLogCacheMetrics(t *testing.T) {
+	tests := []struct {
+		name     string
+		node     LogCacheMetrics
+		pressure float64
+		evicting bool
+	}{
+		{name: "healthy", node: LogCacheMetrics{AvailableMemory: 3e9, TotalMemory: 4e9, CachePeriod: float64(time.Hour / time.Millisecond)}, pressure: 0.25},
+		{name: "evicting", node: LogCacheMetrics{AvailableMemory: 1e9, TotalMemory: 4e9, CachePeriod: float64(5 * time.Minute / time.Millisecond)}, pressure: 0.75, evicting: true},
+		{name: "no period reported", node: LogCacheMetrics{AvailableMemory: 0.4e9, TotalMemory: 4e9}, pressure: 0.9},
+		{name: "no memory reported", node: LogCacheMetrics{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.node.MemoryPressure(); got != tt.pressure {
+				t.Errorf("MemoryPressure() = %v, expected %v", got, tt.pressure)
+			}
+			if got := tt.node.Evicting(15 * time.Minute); got != tt.evicting {
+				t.Errorf("Evicting(15m) = %v, expected %v", got, tt.evicting)
+			}
+		})
+	}
+}
+
+func TestCollectLogCacheNodes(t *testing.T) {
+	updateQeries("2m", "5m", "index")
+	results := map[string][]*logcache_v1.PromQL_Sample{
+		formatQuery(lcSystemMemGauge, logCacheSID, "", queryNameSumBy):     {promSample(1e9, "index", "0"), promSample(3e9, "index", "1")},
+		formatQuery(lcTotalMemGauge, logCacheSID, "", queryNameSumBy):      {promSample(4e9, "index", "0"), promSample(4e9, "index", "1")},
+		formatQuery(lcExpiredCounter, logCacheSID, "", queryNameRateBy):    {promSample(250, "index", "0")},
+		formatQuery(lcCachePeriodGauge, logCacheSID, "", queryNameMinBy):   {promSample(3600000, "index", "0"), promSample(60000, "index", "1")},
+		formatQuery(lcnErrCounter, logCacheNozzleSID, "", queryNameRateBy): {promSample(0.5, "index", "1")},
+	}
+	nodes := make(map[string]*LogCacheMetrics)
+	if errs := runCollector(t, results, func(lc *LCC, p *queryPool) { lc.collectLogCacheNodes(p, "index", nodes) }); len(errs) != 0 {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+	got := logCacheNodeList(nodes)
+	want := []LogCacheMetrics{
+		// the node holding the least history comes first
+		{Name: "1", AvailableMemory: 3e9, TotalMemory: 4e9, CachePeriod: 60000, NozzleErrors: 0.5},
+		{Name: "0", AvailableMemory: 1e9, TotalMemory: 4e9, Expired: 250, CachePeriod: 3600000},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d nodes got %v", len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("node %d = %+v, expected %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		bytes float64
+		want  string
+	}{
+		{0, "0.0B"},
+		{1023, "1023.0B"},
+		{1536, "1.5KB"},
+		{4 * 1024 * 1024 * 1024, "4.0GB"},
+		{2 * 1024 * 1024 * 1024 * 1024 * 1024, "2048.0TB"},
+	}
+	for _, tt := range tests {
+		if got := formatBytes(tt.bytes); got != tt.want {
+			t.Errorf("formatBytes(%v) = %s, expected %s", tt.bytes, got, tt.want)
+		}
+	}
+}
@@ -20,13 +20,59 @@ var (
 	cfCLI          plugin.CliConnection
 	sampleDuration *string
 	sampleOffset   *string
+	concurrency    *int
+	cycleTimeout   *time.Duration
+	instanceLabel  *string
+	dopplerSort    *string
+	topAgents      *int
+	lcRetention    *time.Duration
+	profile        *string
+	topApps        *int
+	trendWindow    *time.Duration
+	catalogFile    *string
+	groupBy        *string
+	jobFilter      *string
+	skewThreshold  *float64
+	once           *bool
+	format         *string
+	recordFile     *string
 	firehoseUsage  = `
 
 cf firehose-analyzer <options>
+cf firehose-analyzer sources <options>
+cf firehose-analyzer catalog [--catalog <file>]
+cf firehose-analyzer replay <options> <archive>
+cf firehose-analyzer analyze-files <options> <directory>
+cf firehose-analyzer import <options> <capture>...
+cf firehose-analyzer nozzle <options>
 
 Options
 -d <duration>  - default is 5m					
--o <offset>    - default is 2m`
+-o <offset>    - default is 2m
+-c <queries>   - max concurrent log-cache queries, default is 8
+-t <timeout>   - deadline for each collection cycle, default is 25s
+-l <label>     - label identifying doppler and log cache instances, index or ip, default is index
+-s <column>    - sort doppler instances by name, subscriptions, ingress, egress,
+                 dropped, ingress-dropped or sink-dropped, default is ingress
+-n <count>     - number of dropping agents to list, default is 10
+-k <multiple>  - warn when a doppler's ingress is this multiple of the mean, default is 2
+-r <retention> - expected log cache retention, default is 15m
+-a <count>     - number of noisiest apps to list, default is 10
+-w <window>    - history shown as trend sparklines, 0 disables trends, default is 30m
+--once         - collect a single snapshot, print a static report and exit with
+                 0 when all checks pass, 1 on warnings, 2 on critical and 3 when
+                 the report could not be produced
+--format <fmt> - text or json, json prints one snapshot document with --once and
+                 one document per line (ndjson) per collection otherwise
+--record <file> - append every collected snapshot to a compressed archive that
+                 can be played back with replay
+--catalog <file> - yaml or json query catalog that adds or overrides built in panels
+--group-by <label> - show doppler, metron, rlp and syslog rows per deployment, az,
+                 job or any other log-cache label
+--jobs <names> - comma separated instance groups shown in the instance table,
+                 default is every job reported by bosh system metrics
+--profile <name> - query profile legacy, syslog-agent or forwarder-agent,
+                 default is auto which detects the platform version` + transportUsage
 )
 
 // BasicPlugin implement cf cli plugin api
@@ -34,25 +80,105 @@ type BasicPlugin struct{}
 
 // Run execute the firehose analyzer tool
 func (c *BasicPlugin) Run(cliConnection plugin.CliConnection, args []string) {
+	cfCLI = cliConnection
+	if args[0] == "firehose-analyzer" && len(args) > 1 && args[1] == "sources" {
+		startSources(args[2:])
+		return
+	}
+	if args[0] == "firehose-analyzer" && len(args) > 1 && args[1] == "catalog" {
+		startCatalog(args[2:])
+		return
+	}
+	if args[0] == "firehose-analyzer" && len(args) > 1 && args[1] == "replay" {
+		startReplay(args[2:])
+		return
+	}
+	if args[0] == "firehose-analyzer" && len(args) > 1 && args[1] == "analyze-files" {
+		startAnalyzeFiles(args[2:])
+		return
+	}
+	if args[0] == "firehose-analyzer" && len(args) > 1 && args[1] == "import" {
+		startImport(args[2:])
+		return
+	}
+	if args[0] == "firehose-analyzer" && len(args) > 1 && args[1] == "nozzle" {
+		startNozzle(args[2:])
+		return
+	}
 
-	fs := flag.NewFlagSet("firehose-args", flag.ExitOnError)
-	sampleDuration = fs.String("d", "5m", "Specify sample duration")
-	sampleOffset = fs.String("o", "2m", "Specify sample offset")
+	reporting = onceRequested(args[1:])
+	fs := flag.NewFlagSet("firehose-args", flag.ContinueOnError)
+	addAnalyzerFlags(fs)
+	addTransportFlags(fs)
 	fs.Usage = func() { fmt.Println(firehoseUsage) }
-	err := fs.Parse(args[1:])
-	if err != nil {
+	parseFlags(fs, args[1:])
+	if err := validateAnalyzerFlags(); err != nil {
 		fmt.Println(err)
-		os.Exit(1)
+		os.Exit(setupExitCode())
 	}
 
 	// Ensure that we called the command basic-plugin-command
-	cfCLI = cliConnection
 	if args[0] == "firehose-analyzer" {
 		startAnalyzer()
 	}
 
 }
 
+// addAnalyzerFlags registers the collection and display flags on fs
+func addAnalyzerFlags(fs *flag.FlagSet) {
+	sampleDuration = fs.String("d", "5m", "Specify sample duration")
+	sampleOffset = fs.String("o", "2m", "Specify sample offset")
+	concurrency = fs.Int("c", 8, "Specify max concurrent log-cache queries")
+	cycleTimeout = fs.Duration("t", 25*time.Second, "Specify deadline for each collection cycle")
+	addDisplayFlags(fs)
+	recordFile = fs.String("record", "", "Specify archive file snapshots are appended to")
+	format = fs.String("format", formatText, "Specify output format")
+	once = fs.Bool("once", false, "Specify to print a single report and exit")
+	profile = fs.String("profile", autoProfile, "Specify query profile")
+	topApps = fs.Int("a", 10, "Specify number of noisiest apps to list")
+	trendWindow = fs.Duration("w", 30*time.Minute, "Specify trend window")
+	catalogFile = fs.String("catalog", "", "Specify query catalog file")
+	groupBy = fs.String("group-by", "", "Specify label used to group panels")
+	jobFilter = fs.String("jobs", "", "Specify instance groups to show")
+}
+
+// validateAnalyzerFlags checks the values of the flags registered by addAnalyzerFlags
+func validateAnalyzerFlags() error {
+	if err := validateDisplayFlags(); err != nil {
+		return err
+	}
+	if err := validGroupLabel(*groupBy); err != nil {
+		return err
+	}
+	if *topApps < 0 {
+		return fmt.Errorf("invalid app count %d expected 0 or more", *topApps)
+	}
+	return validFormat(*format)
+}
+
+// validateDisplayFlags checks the values of the flags registered by addDisplayFlags
+func validateDisplayFlags() error {
+	if *instanceLabel != "index" && *instanceLabel != "ip" {
+		return fmt.Errorf("invalid instance label \"%s\" expected index or ip", *instanceLabel)
+	}
+	if err := validSortColumn(*dopplerSort, dopplerSortColumns); err != nil {
+		return err
+	}
+	if *topAgents < 0 {
+		return fmt.Errorf("invalid agent count %d expected 0 or more", *topAgents)
+	}
+	return validSkewThreshold(*skewThreshold)
+}
+
+// addDisplayFlags registers the flags used to render a snapshot on fs
+func addDisplayFlags(fs *flag.FlagSet) {
+	instanceLabel = fs.String("l", "index", "Specify label identifying doppler and log cache instances")
+	dopplerSort = fs.String("s", "ingress", "Specify doppler instance sort column")
+	topAgents = fs.Int("n", 10, "Specify number of dropping agents to list")
+	skewThreshold = fs.Float64("k", 2, "Specify doppler ingress skew threshold")
+	lcRetention = fs.Duration("r", 15*time.Minute, "Specify expected log cache retention")
+}
+
 // GetMetadata interface for plugin api
 func (c *BasicPlugin) GetMetadata() plugin.PluginMetadata {
 	return plugin.PluginMetadata{
@@ -87,6 +213,9 @@ const (
 	dopplerJob = "doppler"
 	metronJob  = "metron"
 
+	syslogAdapterJob   = "syslog_adapter"
+	syslogSchedulerJob = "syslog_scheduler"
+
 	trafficControllerSID   = "traffic_controller"
 	dopplerSID             = "doppler"
 	syslogDrainAdapterSID  = "drain_adapter"
@@ -105,10 +234,19 @@ const (
 	subscriptionsGauge = "subscriptions"
 
 	// boshSystemMetricsSID metrics
-	cpuUserGauge       = "system_cpu_user"
-	cpuWaitGauge       = "system_cpu_wait"
-	cpuSYSGauge        = "system_cpu_sys"
-	memoryPercentGauge = "system_mem_percent"
+	cpuUserGauge        = "system_cpu_user"
+	cpuWaitGauge        = "system_cpu_wait"
+	cpuSYSGauge         = "system_cpu_sys"
+	memoryPercentGauge  = "system_mem_percent"
+	diskSystemGauge     = "system_disk_system_percent"
+	diskEphemeralGauge  = "system_disk_ephemeral_percent"
+	diskPersistentGauge = "system_disk_persistent_percent"
+	load1mGauge         = "system_load_1m"
+	swapPercentGauge    = "system_swap_percent"
+	netBytesInCounter   = "system_network_bytes_received"
+	netBytesOutCounter  = "system_network_bytes_sent"
+	netErrorsInCounter  = "system_network_errors_in"
+	netErrorsOutCounter = "system_network_errors_out"
 
 	// trafficControllerSID metrics
 	slowConsumerCounter          = "doppler_proxy_slow_consumer"
@@ -129,6 +267,9 @@ const (
 	drainsInvlaidGauge     = "invalid_drains"
 	drainsGauge            = "drains"
 
+	// syslogDrainAdapterSID metrics
+	drainBindingsGauge = "drain_bindings"
+
 	// metronSID
 	averageEnvelopGauge = "average_envelope" // bytes/minute
 
@@ -142,21 +283,54 @@ const (
 	lcnErrCounter = "err"
 )
 
+// logCacheAddress derives the log-cache url from the targeted api endpoint
+func logCacheAddress() string {
+	apiURL, err := cfCLI.ApiEndpoint()
+	if err != nil {
+		fatalln(err)
+	}
+	return fmt.Sprintf("https://log-cache.%s", apiURL[12:len(apiURL)])
+}
+
 func startAnalyzer() {
-	fmt.Println("Inializing Analyzer...")
+	// keep stdout clean for json consumers
+	status := statusOutput()
+	logger.SetOutput(status)
+	fmt.Fprintln(status, "Inializing Analyzer...")
 	mc = Metrics{}
-	apiURL, err := cfCLI.ApiEndpoint()
+	catalog, err := LoadCatalog(*catalogFile)
 	if err != nil {
-		logger.Fatalln(err)
+		fatalln(err)
 	}
-	sysDomain := fmt.Sprintf("https://log-cache.%s", apiURL[12:len(apiURL)])
-	lcc, err := NewLogCacheClient(sysDomain)
+	lcc, err := newLogCacheClient(*concurrency, *cycleTimeout)
 	if err != nil {
-		logger.Fatalf("Could not create log cache client: %s\n", err)
+		fatalf("Could not create log cache client: %s\n", err)
+	}
+	lcc.Catalog = catalog
+	if err := lcc.SelectProfile(*profile); err != nil {
+		fatalln(err)
+	}
+	fmt.Fprintf(status, "Using query profile %s (%s)\n", lcc.Profile.Name, lcc.ProfileReason)
+	if *recordFile != "" {
+		if err := openArchive(*recordFile); err != nil {
+			fatalln(err)
+		}
+	}
+	if *once {
+		os.Exit(runOnce(lcc))
+	}
+	if *format == formatJSON {
+		for {
+			collectAndRecord(lcc)
+			if err := writeSnapshotJSON(os.Stdout, lcc.Snapshot(), false); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			time.Sleep(30 * time.Second)
+		}
 	}
-	go loopTerm(&lcc)
+	go loopTerm(lcc)
 	for {
-		lcc.Collect()
+		collectAndRecord(lcc)
 		time.Sleep(30 * time.Second)
 	}
 }
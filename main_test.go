@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+)
+
+// TestMain registers every flag with its default value since the collectors and
+// reports read them through package globals
+func TestMain(m *testing.M) {
+	logger = log.New(ioutil.Discard, "logger: ", 0)
+	fs := flag.NewFlagSet("firehose-test-args", flag.ContinueOnError)
+	addAnalyzerFlags(fs)
+	addTransportFlags(fs)
+	os.Exit(m.Run())
+}
+
+func TestValidateAnalyzerFlags(t *testing.T) {
+	tests := []struct {
+		args    []string
+		wantErr bool
+	}{
+		{args: []string{}},
+		{args: []string{"-n", "0", "-a", "0"}},
+		{args: []string{"-l", "ip", "-s", "dropped", "-k", "3", "--format", "json"}},
+		{args: []string{"-n", "-1"}, wantErr: true},
+		{args: []string{"-a", "-1"}, wantErr: true},
+		{args: []string{"-l", "name"}, wantErr: true},
+		{args: []string{"-s", "volume"}, wantErr: true},
+		{args: []string{"--format", "yaml"}, wantErr: true},
+	}
+	// restore the defaults for the other tests
+	defer addAnalyzerFlags(flag.NewFlagSet("firehose-test-args", flag.ContinueOnError))
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("firehose-test-args", flag.ContinueOnError)
+		addAnalyzerFlags(fs)
+		if err := fs.Parse(tt.args); err != nil {
+			t.Fatalf("%v: %s", tt.args, err)
+		}
+		if err := validateAnalyzerFlags(); (err != nil) != tt.wantErr {
+			t.Errorf("%v: expected error %v got %v", tt.args, tt.wantErr, err)
+		}
+	}
+}
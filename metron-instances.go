@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// metronInstanceLabels labels used to attribute agent metrics to a single vm
+const metronInstanceLabels = "deployment,job,index"
+
+// collectMetronInstances schedules the per vm agent queries for the agent sourceid.
+// Results are stored in instances keyed by deployment/job/index
+func (lc *LCC) collectMetronInstances(p *queryPool, sourceid string, instances map[string]*MetronMetrics) {
+	get := func(labels map[string]string) *MetronMetrics {
+		name := fmt.Sprintf("%s/%s/%s", labels["deployment"], labels["job"], labels["index"])
+		m, ok := instances[name]
+		if !ok {
+			m = &MetronMetrics{Name: name, Deployment: labels["deployment"], Job: labels["job"], Index: labels["index"]}
+			instances[name] = m
+		}
+		return m
+	}
+	lc.groupedBy(p, ingressCounter, sourceid, "", queryAgentRateBy, func(l map[string]string, v float64) { get(l).Ingress = v })
+	lc.groupedBy(p, egressCounter, sourceid, "", queryAgentRateBy, func(l map[string]string, v float64) { get(l).Egress = v })
+	lc.groupedBy(p, droppedCounter, sourceid, "", queryAgentRateBy, func(l map[string]string, v float64) { get(l).Dropped = v })
+}
+
+// metronInstanceList flattens the instance map into a slice ordered by drop rate
+func metronInstanceList(instances map[string]*MetronMetrics) []MetronMetrics {
+	m := make([]MetronMetrics, 0, len(instances))
+	for _, i := range instances {
+		m = append(m, *i)
+	}
+	sort.SliceStable(m, func(i, j int) bool {
+		if m[i].Dropped == m[j].Dropped {
+			return m[i].Name < m[j].Name
+		}
+		return m[i].Dropped > m[j].Dropped
+	})
+	return m
+}
+
+// topMetronDroppers returns at most n agents that dropped envelopes along with the
+// share of all agent drops they account for
+func topMetronDroppers(instances []MetronMetrics, n int) ([]MetronMetrics, float64) {
+	var total, top float64
+	droppers := make([]MetronMetrics, 0, n)
+	for _, i := range instances {
+		total += i.Dropped
+		if i.Dropped > 0 && len(droppers) < n {
+			droppers = append(droppers, i)
+			top += i.Dropped
+		}
+	}
+	if total == 0 {
+		return droppers, 0
+	}
+	return droppers, top / total
+}
@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func TestMetronInstanceList(t *testing.T) {
+	instances := map[string]*MetronMetrics{
+		"cf/router/0":     {Name: "cf/router/0", Dropped: 5},
+		"cf/diego-cell/1": {Name: "cf/diego-cell/1", Dropped: 20},
+		"cf/diego-cell/0": {Name: "cf/diego-cell/0", Dropped: 5},
+		"cf/api/0":        {Name: "cf/api/0"},
+	}
+	want := []string{"cf/diego-cell/1", "cf/diego-cell/0", "cf/router/0", "cf/api/0"}
+	got := metronInstanceList(instances)
+	if len(got) != len(want) {
+		t.Fatalf("expected %d instances got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i].Name != want[i] {
+			t.Errorf("position %d: expected %s got %s", i, want[i], got[i].Name)
+		}
+	}
+}
+
+func TestTopMetronDroppers(t *testing.T) {
+	instances := []MetronMetrics{
+		{Name: "cf/diego-cell/1", Dropped: 60},
+		{Name: "cf/diego-cell/0", Dropped: 30},
+		{Name: "cf/router/0", Dropped: 10},
+		{Name: "cf/api/0"},
+	}
+	tests := []struct {
+		name      string
+		instances []MetronMetrics
+		n         int
+		want      []string
+		share     float64
+	}{
+		{name: "top two", instances: instances, n: 2, want: []string{"cf/diego-cell/1", "cf/diego-cell/0"}, share: 0.9},
+		{name: "every dropper", instances: instances, n: 10, want: []string{"cf/diego-cell/1", "cf/diego-cell/0", "cf/router/0"}, share: 1},
+		{name: "none listed", instances: instances, n: 0, want: []string{}, share: 0},
+		{name: "no drops", instances: []MetronMetrics{{Name: "cf/api/0"}}, n: 10, want: []string{}, share: 0},
+		{name: "no agents", n: 10, want: []string{}, share: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, share := topMetronDroppers(tt.instances, tt.n)
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %v got %+v", tt.want, got)
+			}
+			for i := range tt.want {
+				if got[i].Name != tt.want[i] {
+					t.Errorf("position %d: expected %s got %s", i, tt.want[i], got[i].Name)
+				}
+			}
+			if share != tt.share {
+				t.Errorf("expected share %v got %v", tt.share, share)
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+var nozzleUsage = `
+
+cf firehose-analyzer nozzle <options>
+
+Subscribes to the traffic controller firehose and builds the report from the
+ValueMetric and CounterEvent envelopes received during each interval instead of
+querying log-cache.  Useful when log-cache is down or under-sized.  The user needs
+the doppler.firehose scope.
+
+Options
+-i <interval>  - length of each sample window, default is 30s
+--subscription <id> - firehose subscription id, nozzles sharing an id split the
+                 envelopes between them, default is firehose-analyzer
+--profile <name> - legacy, syslog-agent or forwarder-agent, default is auto which
+                 detects the platform from the received source ids
+--once, --format, --record - report the first window only, print json or record
+                 snapshots the same as the live analyzer
+--ca, --skip-ssl-validation - verify the firehose certificate the same way as the
+                 log-cache gateway
+-l, -s, -n, -k, -r, --catalog, --jobs - same as the live analyzer`
+
+// nozzleReconnectDelay wait before the firehose is dialed again after an error
+const nozzleReconnectDelay = 5 * time.Second
+
+// nozzle reads the firehose into an envelope store that is turned into a snapshot at
+// the end of every sample window
+type nozzle struct {
+	url         string
+	tlsConfig   *tls.Config
+	catalog     Catalog
+	profileName string
+
+	mux         sync.Mutex
+	store       *envelopeStore
+	windowStart time.Time
+	errors      []error
+	profile     *QueryProfile // kept once detected so an empty window does not lose it
+	reason      string
+	received    uint64
+
+	snapshot   atomic.Value
+	collecting int32
+}
+
+func newNozzle(url string, tlsConfig *tls.Config, profileName string, catalog Catalog) *nozzle {
+	return &nozzle{url: url, tlsConfig: tlsConfig, profileName: profileName, catalog: catalog, store: newEnvelopeStore(), windowStart: time.Now()}
+}
+
+// firehoseAddress derives the firehose url of subscription from the doppler endpoint
+func firehoseAddress(subscription string) string {
+	endpoint, err := cfCLI.DopplerEndpoint()
+	if err != nil {
+		fatalln(err)
+	}
+	return fmt.Sprintf("%s/firehose/%s", endpoint, subscription)
+}
+
+// recordError keeps err for the snapshot of the current window
+func (n *nozzle) recordError(err error) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	n.errors = append(n.errors, err)
+}
+
+// connect dials the firehose with a fresh token
+func (n *nozzle) connect() (*wsConn, error) {
+	token, err := cfCLI.AccessToken()
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	header.Set("Authorization", token)
+	return dialWebsocket(n.url, header, n.tlsConfig)
+}
+
+// consume reads the firehose until the connection fails
+func (n *nozzle) consume() error {
+	ws, err := n.connect()
+	if err != nil {
+		return fmt.Errorf("could not connect to firehose: %s", err)
+	}
+	defer ws.Close()
+	for {
+		msg, err := ws.ReadMessage()
+		if err != nil {
+			return fmt.Errorf("firehose connection closed: %s", err)
+		}
+		var e Envelope
+		if err := proto.Unmarshal(msg, &e); err != nil {
+			n.recordError(fmt.Errorf("could not decode envelope: %s", err))
+			continue
+		}
+		n.mux.Lock()
+		n.store.Add(&e)
+		n.received++
+		n.mux.Unlock()
+	}
+}
+
+// Run consumes the firehose forever reconnecting after errors
+func (n *nozzle) Run() {
+	for {
+		err := n.consume()
+		n.recordError(err)
+		logger.Println(err)
+		time.Sleep(nozzleReconnectDelay)
+	}
+}
+
+// Rotate ends the current sample window and stores its snapshot
+func (n *nozzle) Rotate() {
+	atomic.StoreInt32(&n.collecting, 1)
+	defer atomic.StoreInt32(&n.collecting, 0)
+
+	n.mux.Lock()
+	store, errs, received := n.store, n.errors, n.received
+	start, stop := n.windowStart, time.Now()
+	n.store, n.errors, n.received, n.windowStart = newEnvelopeStore(), nil, 0, stop
+	n.mux.Unlock()
+
+	store.span = stop.Sub(start)
+	if received == 0 {
+		errs = append(errs, fmt.Errorf("no envelopes received from the firehose"))
+	}
+	p, reason, err := captureProfile(store, n.profileName)
+	switch {
+	case err == nil:
+		n.profile, n.reason = &p, reason
+	case n.profile != nil:
+		p, reason = *n.profile, n.reason
+	default:
+		p, reason = queryProfiles["syslog-agent"], "no profile detected yet, assuming syslog-agent"
+		errs = append(errs, err)
+	}
+	s := storeSnapshot(store, p, reason, n.catalog, errs)
+	s.Start, s.Stop = start, stop
+	n.snapshot.Store(s)
+}
+
+// Snapshot returns the snapshot of the last completed window
+func (n *nozzle) Snapshot() *Snapshot {
+	s, _ := n.snapshot.Load().(*Snapshot)
+	return s
+}
+
+// Collecting reports whether a window is being turned into a snapshot
+func (n *nozzle) Collecting() bool {
+	return atomic.LoadInt32(&n.collecting) == 1
+}
+
+// rotateAndRecord ends the current window and appends its snapshot to the archive
+// when recording is enabled
+func (n *nozzle) rotateAndRecord() {
+	n.Rotate()
+	if !arvhiveEnabled {
+		return
+	}
+	if err := recordSnapshot(n.Snapshot()); err != nil {
+		logger.Printf("Could not record snapshot: %s\n", err)
+	}
+}
+
+func startNozzle(args []string) {
+	reporting = onceRequested(args)
+	fs := flag.NewFlagSet("firehose-nozzle-args", flag.ContinueOnError)
+	addAnalyzerFlags(fs)
+	addTransportFlags(fs)
+	interval := fs.Duration("i", 30*time.Second, "Specify sample window")
+	subscription := fs.String("subscription", "firehose-analyzer", "Specify firehose subscription id")
+	fs.Usage = func() { fmt.Println(nozzleUsage) }
+	parseFlags(fs, args)
+	if err := validateAnalyzerFlags(); err != nil {
+		fmt.Println(err)
+		os.Exit(setupExitCode())
+	}
+	status := statusOutput()
+	logger.SetOutput(status)
+	if *interval <= 0 {
+		fmt.Println("interval must be greater than 0")
+		os.Exit(setupExitCode())
+	}
+	if *profile != autoProfile {
+		if _, ok := queryProfiles[*profile]; !ok {
+			fmt.Printf("unknown profile \"%s\"\n", *profile)
+			os.Exit(setupExitCode())
+		}
+	}
+	catalog, err := LoadCatalog(*catalogFile)
+	if err != nil {
+		fatalln(err)
+	}
+	tlsConfig, err := httpsTLSConfig(*grpcCA)
+	if err != nil {
+		fatalln(err)
+	}
+	if *recordFile != "" {
+		if err := openArchive(*recordFile); err != nil {
+			fatalln(err)
+		}
+	}
+	// the nozzle has no history to query
+	*trendWindow = 0
+
+	n := newNozzle(firehoseAddress(*subscription), tlsConfig, *profile, catalog)
+	fmt.Fprintf(status, "Reading %s for %s windows...\n", n.url, *interval)
+	go n.Run()
+
+	if *once {
+		time.Sleep(*interval)
+		n.rotateAndRecord()
+		os.Exit(reportSnapshot(n.Snapshot()))
+	}
+	if *format == formatJSON {
+		for {
+			time.Sleep(*interval)
+			n.rotateAndRecord()
+			if err := writeSnapshotJSON(os.Stdout, n.Snapshot(), false); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}
+	}
+	go loopTerm(n)
+	for {
+		time.Sleep(*interval)
+		n.rotateAndRecord()
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"code.cloudfoundry.org/cli/plugin"
+	"github.com/golang/protobuf/proto"
+	"github.com/gorilla/websocket"
+)
+
+// tokenCLI cf cli connection that only hands out a token
+type tokenCLI struct {
+	plugin.CliConnection
+}
+
+func (tokenCLI) AccessToken() (string, error) {
+	return "bearer firehose-token", nil
+}
+
+func TestNozzleRotate(t *testing.T) {
+	cfCLI = tokenCLI{}
+	defer func() { cfCLI = nil }()
+
+	envelopes := []*Envelope{
+		counterEnvelope(dopplerSID, dopplerJob, "0", ingressCounter, 400, 400, 0),
+		counterEnvelope(dopplerSID, dopplerJob, "0", ingressCounter, 600, 1000, time.Second),
+		counterEnvelope(dopplerSID, dopplerJob, "1", ingressCounter, 1000, 9000, time.Second),
+		counterEnvelope(dopplerSID, dopplerJob, "1", droppedCounter, 20, 20, time.Second),
+		counterEnvelope(syslogAgentSID, "diego-cell", "0", ingressCounter, 100, 100, time.Second),
+		{Origin: proto.String("rep"), EventType: eventType(5)},
+	}
+	tokens := make(chan string, 1)
+	url := wsServer(t, func(c *websocket.Conn, r *http.Request) {
+		tokens <- r.Header.Get("Authorization")
+		for _, e := range envelopes {
+			b, err := proto.Marshal(e)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			c.WriteMessage(websocket.BinaryMessage, b)
+		}
+		c.WriteMessage(websocket.BinaryMessage, []byte{0xff, 0xff})
+		drain(c)
+	})
+
+	catalog, err := LoadCatalog("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := newNozzle(url+"/firehose/analyzer", nil, autoProfile, catalog)
+	go n.consume()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		n.mux.Lock()
+		received := n.received
+		n.mux.Unlock()
+		if received == uint64(len(envelopes)) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("received %d of %d envelopes", received, len(envelopes))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	window := 10 * time.Second
+	n.mux.Lock()
+	n.windowStart = time.Now().Add(-window)
+	n.mux.Unlock()
+	n.Rotate()
+
+	s := n.Snapshot()
+	if auth := <-tokens; auth != "bearer firehose-token" {
+		t.Errorf("expected the user's token got %q", auth)
+	}
+	if s.Profile != "syslog-agent" {
+		t.Errorf("expected the syslog-agent profile to be detected got %s (%s)", s.Profile, s.ProfileReason)
+	}
+	elapsed := s.Stop.Sub(s.Start)
+	if elapsed < window || elapsed > window+time.Second {
+		t.Fatalf("expected a %s window got %s", window, elapsed)
+	}
+	// 2000 envelopes over the window
+	if want := 2000 / elapsed.Seconds(); s.Metric.Doppler.Ingress != want {
+		t.Errorf("expected doppler ingress %v/s got %v", want, s.Metric.Doppler.Ingress)
+	}
+	if want := 20 / elapsed.Seconds(); s.Metric.Doppler.Dropped != want {
+		t.Errorf("expected doppler dropped %v/s got %v", want, s.Metric.Doppler.Dropped)
+	}
+	if len(s.CollectionErrors) != 1 {
+		t.Errorf("expected the undecodable envelope to be reported got %v", s.CollectionErrors)
+	}
+
+	// the next window is empty but keeps the detected profile
+	n.Rotate()
+	s = n.Snapshot()
+	if s.Profile != "syslog-agent" || s.Metric.Doppler.Ingress != 0 {
+		t.Errorf("expected an empty syslog-agent window got %s with ingress %v", s.Profile, s.Metric.Doppler.Ingress)
+	}
+	if len(s.CollectionErrors) != 1 {
+		t.Errorf("expected the empty window to be reported got %v", s.CollectionErrors)
+	}
+}
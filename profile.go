@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/blang/semver"
+)
+
+const (
+	forwarderAgentSID = "forwarder_agent"
+
+	autoProfile = "auto"
+)
+
+// QueryProfile describes which loggregator generation is deployed and therefore
+// which source ids the collector should query
+type QueryProfile struct {
+	Name          string
+	Description   string
+	AgentSID      string // source id of the loggregator agents
+	SyslogAgent   bool   // drains are handled by syslog agents
+	SyslogAdapter bool   // drains are handled by cf-syslog-drain adapters and schedulers
+}
+
+var queryProfiles = map[string]QueryProfile{
+	"legacy": {
+		Name:          "legacy",
+		Description:   "PAS 2.6 or earlier, metron agents with cf-syslog-drain",
+		AgentSID:      metronSID,
+		SyslogAdapter: true,
+	},
+	"syslog-agent": {
+		Name:        "syslog-agent",
+		Description: "PAS 2.7, metron agents with syslog agents",
+		AgentSID:    metronSID,
+		SyslogAgent: true,
+	},
+	"forwarder-agent": {
+		Name:        "forwarder-agent",
+		Description: "forwarder agents with syslog agents",
+		AgentSID:    forwarderAgentSID,
+		SyslogAgent: true,
+	},
+}
+
+// firstSyslogAgentLogCacheVersion log-cache release that shipped with the syslog agent.
+// Only used when the source ids in log-cache are not conclusive.  The cutoff comes from
+// the component versions in the PAS release notes: PAS 2.6 ships log-cache 2.1.x and
+// PAS 2.7, the first release with syslog agents, ships log-cache 2.2.x.  This matches
+// the 1.2.x (PAS 2.6) and 1.3.x (PAS 2.7) plugin split in the README
+var firstSyslogAgentLogCacheVersion = semver.Version{Major: 2, Minor: 2, Patch: 0}
+
+// profileNames sorted list of known profiles
+func profileNames() []string {
+	names := make([]string, 0, len(queryProfiles))
+	for n := range queryProfiles {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SelectProfile sets the query profile.  When name is auto the profile is detected
+// from the source ids held in log-cache and the log-cache version
+func (lc *LCC) SelectProfile(name string) error {
+	if name != autoProfile {
+		p, ok := queryProfiles[name]
+		if !ok {
+			return fmt.Errorf("unknown profile \"%s\" expected one of auto, %s", name, strings.Join(profileNames(), ", "))
+		}
+		lc.Profile = p
+		lc.ProfileReason = "selected with --profile"
+		return nil
+	}
+
+	lc.checkToken()
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	meta, err := lc.client.Meta(ctx)
+	if err == nil {
+		p, reason, ok := profileFromSources(func(sid string) bool { return meta[sid] != nil })
+		if ok {
+			lc.Profile, lc.ProfileReason = p, reason
+			return nil
+		}
+	}
+
+	v, verr := lc.client.LogCacheVersion(ctx)
+	if verr != nil {
+		if err != nil {
+			return fmt.Errorf("could not detect profile, meta: %s, version: %s", err, verr)
+		}
+		return fmt.Errorf("could not detect profile: %s", verr)
+	}
+	if v.GTE(firstSyslogAgentLogCacheVersion) {
+		lc.Profile = queryProfiles["syslog-agent"]
+	} else {
+		lc.Profile = queryProfiles["legacy"]
+	}
+	lc.ProfileReason = fmt.Sprintf("detected log-cache version %s", v)
+	return nil
+}
+
+// profileFromSources detects the profile from the source ids reported by the platform.
+// ok is false when none of the source ids are conclusive
+func profileFromSources(has func(sid string) bool) (p QueryProfile, reason string, ok bool) {
+	for _, d := range []struct {
+		sid     string
+		profile string
+	}{
+		{forwarderAgentSID, "forwarder-agent"},
+		{syslogAgentSID, "syslog-agent"},
+		{syslogDrainAdapterSID, "legacy"},
+		{syslogDrainScheduleSID, "legacy"},
+	} {
+		if has(d.sid) {
+			return queryProfiles[d.profile], fmt.Sprintf("detected %s source id", d.sid), true
+		}
+	}
+	return QueryProfile{}, "", false
+}
@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestProfileFromSources(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources []string
+		profile string
+		reason  string
+	}{
+		{name: "forwarder agent", sources: []string{"forwarder_agent", "syslog_agent"}, profile: "forwarder-agent", reason: "detected forwarder_agent source id"},
+		{name: "syslog agent", sources: []string{"syslog_agent", "drain_adapter"}, profile: "syslog-agent", reason: "detected syslog_agent source id"},
+		{name: "drain adapter", sources: []string{"drain_adapter"}, profile: "legacy", reason: "detected drain_adapter source id"},
+		{name: "drain scheduler only", sources: []string{"drain_scheduler"}, profile: "legacy", reason: "detected drain_scheduler source id"},
+		{name: "inconclusive", sources: []string{"doppler"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			has := func(sid string) bool {
+				for _, s := range tt.sources {
+					if s == sid {
+						return true
+					}
+				}
+				return false
+			}
+			p, reason, ok := profileFromSources(has)
+			if ok != (tt.profile != "") {
+				t.Fatalf("expected detection %v got %v", tt.profile != "", ok)
+			}
+			if p.Name != tt.profile || reason != tt.reason {
+				t.Errorf("expected %s %q got %s %q", tt.profile, tt.reason, p.Name, reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// ExecutedQuery a promql query run during a collection cycle
+type ExecutedQuery struct {
+	Query    string        `json:"query"`
+	Range    bool          `json:"range"`
+	Duration time.Duration `json:"duration_ns"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// queryLog records the queries of the current collection cycle
+type queryLog struct {
+	mux     sync.Mutex
+	queries []ExecutedQuery
+}
+
+func (l *queryLog) record(q string, isRange bool, start time.Time, err error) {
+	e := ExecutedQuery{Query: q, Range: isRange, Duration: time.Since(start)}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	l.mux.Lock()
+	l.queries = append(l.queries, e)
+	l.mux.Unlock()
+}
+
+// reset returns the recorded queries and starts a new log
+func (l *queryLog) reset() []ExecutedQuery {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	q := l.queries
+	l.queries = nil
+	return q
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// queryPool runs log-cache queries on a bounded number of workers and merges
+// the results back into the metrics being collected
+type queryPool struct {
+	ctx    context.Context
+	sem    chan struct{}
+	wg     sync.WaitGroup
+	mux    sync.Mutex
+	errors []error
+}
+
+func newQueryPool(ctx context.Context, workers int) *queryPool {
+	if workers < 1 {
+		workers = 1
+	}
+	return &queryPool{ctx: ctx, sem: make(chan struct{}, workers), errors: make([]error, 0)}
+}
+
+// Go schedules task running query on the next free worker.  Tasks that are still
+// waiting for a worker when the cycle deadline expires are skipped and recorded as
+// errors naming the query
+func (p *queryPool) Go(query string, task func(ctx context.Context) error) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		select {
+		case p.sem <- struct{}{}:
+		case <-p.ctx.Done():
+			p.addError(fmt.Errorf("%s: %s", query, p.ctx.Err()))
+			return
+		}
+		defer func() { <-p.sem }()
+		if err := task(p.ctx); err != nil {
+			p.addError(err)
+		}
+	}()
+}
+
+// Set stores v in dst while holding the pool lock
+func (p *queryPool) Set(dst *float64, v float64) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	*dst = v
+}
+
+// Do runs f while holding the pool lock so tasks can update shared fields
+func (p *queryPool) Do(f func()) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	f()
+}
+
+// Wait blocks until every scheduled task has finished
+func (p *queryPool) Wait() {
+	p.wg.Wait()
+}
+
+// Errors returns the errors recorded by tasks
+func (p *queryPool) Errors() []error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return p.errors
+}
+
+func (p *queryPool) addError(err error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.errors = append(p.errors, err)
+}
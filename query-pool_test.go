@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestQueryPoolConcurrency(t *testing.T) {
+	tests := []struct {
+		workers int
+		limit   int32
+	}{
+		{workers: 1, limit: 1},
+		{workers: 3, limit: 3},
+		{workers: 0, limit: 1},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d workers", tt.workers), func(t *testing.T) {
+			var running, peak, done int32
+			p := newQueryPool(context.Background(), tt.workers)
+			for i := 0; i < 20; i++ {
+				p.Go(fmt.Sprintf("query %d", i), func(ctx context.Context) error {
+					n := atomic.AddInt32(&running, 1)
+					for {
+						old := atomic.LoadInt32(&peak)
+						if n <= old || atomic.CompareAndSwapInt32(&peak, old, n) {
+							break
+						}
+					}
+					time.Sleep(5 * time.Millisecond)
+					atomic.AddInt32(&running, -1)
+					atomic.AddInt32(&done, 1)
+					return nil
+				})
+			}
+			p.Wait()
+			if done != 20 {
+				t.Errorf("expected every task to run got %d", done)
+			}
+			if peak > tt.limit {
+				t.Errorf("expected at most %d tasks at once got %d", tt.limit, peak)
+			}
+			if len(p.Errors()) != 0 {
+				t.Errorf("unexpected errors %v", p.Errors())
+			}
+		})
+	}
+}
+
+func TestQueryPoolDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	p := newQueryPool(ctx, 1)
+	p.Go("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		// hold the worker past the deadline so the queued task can only see the deadline
+		time.Sleep(50 * time.Millisecond)
+		return fmt.Errorf("slow: %s", ctx.Err())
+	})
+	// give the slow task the only worker
+	time.Sleep(10 * time.Millisecond)
+	var ran int32
+	p.Go(`sum(rate(ingress{source_id="doppler"}[5m]))`, func(ctx context.Context) error {
+		atomic.StoreInt32(&ran, 1)
+		return nil
+	})
+	p.Wait()
+	if ran != 0 {
+		t.Error("expected the queued task to be skipped at the deadline")
+	}
+	errs := p.Errors()
+	if len(errs) != 2 {
+		t.Fatalf("expected the slow and the skipped task to fail got %v", errs)
+	}
+	var skipped bool
+	for _, err := range errs {
+		if strings.HasPrefix(err.Error(), `sum(rate(ingress{source_id="doppler"}[5m])): `) && strings.Contains(err.Error(), "deadline exceeded") {
+			skipped = true
+		}
+	}
+	if !skipped {
+		t.Errorf("expected the skipped query to be named with the deadline error got %v", errs)
+	}
+}
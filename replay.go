@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	tm "github.com/buger/goterm"
+)
+
+// replayInterval used when two recorded snapshots have no usable time between them
+const replayInterval = 30 * time.Second
+
+var replayUsage = `
+
+cf firehose-analyzer replay <options> <archive>
+
+Plays back an archive written with --record.  Type a command and press enter
+  p  pause or resume
+  n  step to the next snapshot and pause
+  b  step back one snapshot and pause
+  +  double the playback speed
+  -  halve the playback speed
+  q  quit
+
+Options
+--speed <x>    - playback speed relative to the recording, default is 1
+--paused       - start paused on the first snapshot
+-l, -s, -n, -k, -r - same as the live analyzer`
+
+// replayer plays recorded snapshots through the terminal ui
+type replayer struct {
+	snaps  []*Snapshot
+	pos    int
+	speed  float64
+	paused bool
+}
+
+// interval time to show the current snapshot at the current speed
+func (r *replayer) interval() time.Duration {
+	d := replayInterval
+	if r.pos+1 < len(r.snaps) {
+		if gap := r.snaps[r.pos+1].Stop.Sub(r.snaps[r.pos].Stop); gap > 0 {
+			d = gap
+		}
+	}
+	return time.Duration(float64(d) / r.speed)
+}
+
+// control applies a command read from stdin.  Returns false to quit
+func (r *replayer) control(cmd string) bool {
+	switch strings.TrimSpace(cmd) {
+	case "q":
+		return false
+	case "p":
+		r.paused = !r.paused
+	case "n":
+		r.paused = true
+		if r.pos+1 < len(r.snaps) {
+			r.pos++
+		}
+	case "b":
+		r.paused = true
+		if r.pos > 0 {
+			r.pos--
+		}
+	case "+":
+		r.speed *= 2
+	case "-":
+		r.speed /= 2
+	}
+	return true
+}
+
+func (r *replayer) draw() {
+	state := fmt.Sprintf("[replay %d/%d speed %gx]", r.pos+1, len(r.snaps), r.speed)
+	if r.paused {
+		state = fmt.Sprintf("[replay %d/%d paused]", r.pos+1, len(r.snaps))
+	}
+	s := r.snaps[r.pos]
+	tm.Clear()
+	tm.MoveCursor(1, 1)
+	tm.Print(renderReport(s, s.ProfileReason, tm.Color(state, tm.YELLOW)))
+	tm.Println("p pause/resume  n next  b back  + faster  - slower  q quit")
+	tm.Flush()
+}
+
+// play redraws the current snapshot and advances on a timer until quit
+func (r *replayer) play(commands <-chan string) {
+	for {
+		r.draw()
+		var timer <-chan time.Time
+		if !r.paused {
+			timer = time.After(r.interval())
+		}
+		select {
+		case cmd, ok := <-commands:
+			if !ok {
+				// stdin closed, play to the end without controls
+				if r.paused {
+					return
+				}
+				commands = nil
+				continue
+			}
+			if !r.control(cmd) {
+				return
+			}
+		case <-timer:
+			if r.pos+1 < len(r.snaps) {
+				r.pos++
+			} else if commands == nil {
+				return
+			} else {
+				r.paused = true
+			}
+		}
+	}
+}
+
+func startReplay(args []string) {
+	fs := flag.NewFlagSet("firehose-replay-args", flag.ExitOnError)
+	speed := fs.Float64("speed", 1, "Specify playback speed")
+	paused := fs.Bool("paused", false, "Specify to start paused")
+	addDisplayFlags(fs)
+	fs.Usage = func() { fmt.Println(replayUsage) }
+	err := fs.Parse(args)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if fs.NArg() != 1 {
+		fmt.Println(replayUsage)
+		os.Exit(1)
+	}
+	if *speed <= 0 {
+		fmt.Printf("invalid speed %g expected a value greater than 0\n", *speed)
+		os.Exit(1)
+	}
+	if err := validateDisplayFlags(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	snaps, err := readArchive(fs.Arg(0))
+	if err != nil {
+		fatalln(err)
+	}
+	commands := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			commands <- scanner.Text()
+		}
+		close(commands)
+	}()
+	r := &replayer{snaps: snaps, speed: *speed, paused: *paused}
+	r.play(commands)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"reflect"
+	"time"
+)
+
+// snapshotSchemaVersion bumped whenever a field of SnapshotDocument changes meaning or
+// is removed.  Adding fields does not change the version
+const snapshotSchemaVersion = 1
+
+// output formats
+const (
+	formatText = "text"
+	formatJSON = "json"
+)
+
+// LossRatios computed loss ratios, 0 when there was no ingress
+type LossRatios struct {
+	DopplerIngress float64 `json:"doppler_ingress"`
+	DopplerSink    float64 `json:"doppler_sink"`
+	Metron         float64 `json:"metron"`
+	RLP            float64 `json:"rlp"`
+	SyslogAgent    float64 `json:"syslog_agent"`
+	SyslogAdapter  float64 `json:"syslog_adapter"`
+}
+
+// SnapshotDocument versioned machine readable form of a Snapshot
+type SnapshotDocument struct {
+	SchemaVersion int             `json:"schema_version"`
+	Start         time.Time       `json:"start"`
+	Stop          time.Time       `json:"stop"`
+	ElapsedMs     int64           `json:"elapsed_ms"`
+	Duration      string          `json:"duration"`
+	Offset        string          `json:"offset"`
+	Profile       string          `json:"profile"`
+	ProfileReason string          `json:"profile_reason"`
+	Queries       []ExecutedQuery `json:"queries"`
+	Metrics       Metrics         `json:"metrics"`
+	Loss          LossRatios      `json:"loss"`
+	Checks        []Check         `json:"checks"`
+	Status        CheckStatus     `json:"status"`
+	Errors        []string        `json:"errors"`
+}
+
+// ratio dropped/ingress or 0 when there was no ingress
+func ratio(dropped, ingress float64) float64 {
+	if ingress <= 0 {
+		return 0
+	}
+	return dropped / ingress
+}
+
+// newSnapshotDocument builds the versioned document for a snapshot
+func newSnapshotDocument(s *Snapshot) SnapshotDocument {
+	m := s.Metric
+	checks := evaluateChecks(s)
+	doc := SnapshotDocument{
+		SchemaVersion: snapshotSchemaVersion,
+		Start:         s.Start,
+		Stop:          s.Stop,
+		ElapsedMs:     int64(s.Elapsed() / time.Millisecond),
+		Duration:      s.Duration,
+		Offset:        s.Offset,
+		Profile:       s.Profile,
+		ProfileReason: s.ProfileReason,
+		Queries:       s.Queries,
+		Metrics:       m,
+		Loss: LossRatios{
+			DopplerIngress: ratio(m.Doppler.Dropped, m.Doppler.Ingress),
+			DopplerSink:    ratio(m.Doppler.SinksDropped+m.Doppler.SinkErrorsDropped, m.Doppler.Ingress),
+			Metron:         ratio(m.Metron.Dropped, m.Metron.Ingress),
+			RLP:            ratio(m.RLP.Dropped, m.RLP.Ingress),
+			SyslogAgent:    ratio(m.Drain.AgentDropped, m.Drain.AgentIngress),
+			SyslogAdapter:  ratio(m.SyslogAdapter.Dropped, m.SyslogAdapter.Ingress),
+		},
+		Checks: checks,
+		Status: worstStatus(checks),
+		Errors: make([]string, 0, len(s.CollectionErrors)),
+	}
+	for _, err := range s.CollectionErrors {
+		doc.Errors = append(doc.Errors, err.Error())
+	}
+	finiteFloats(reflect.ValueOf(&doc).Elem())
+	return doc
+}
+
+// finiteFloats replaces NaN and infinite values in v with 0 because json can not
+// encode them.  Slices and maps are copied first so the snapshot is not modified
+func finiteFloats(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		if f := v.Float(); math.IsNaN(f) || math.IsInf(f, 0) {
+			v.SetFloat(0)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Field(i).CanSet() {
+				finiteFloats(v.Field(i))
+			}
+		}
+	case reflect.Slice:
+		if v.IsNil() {
+			return
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		reflect.Copy(c, v)
+		v.Set(c)
+		for i := 0; i < c.Len(); i++ {
+			finiteFloats(c.Index(i))
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			return
+		}
+		c := reflect.MakeMap(v.Type())
+		for _, k := range v.MapKeys() {
+			e := reflect.New(v.Type().Elem()).Elem()
+			e.Set(v.MapIndex(k))
+			finiteFloats(e)
+			c.SetMapIndex(k, e)
+		}
+		v.Set(c)
+	}
+}
+
+// writeSnapshotJSON writes the snapshot document to w.  indent is used for one-shot
+// reports, continuous mode writes one compact document per line
+func writeSnapshotJSON(w io.Writer, s *Snapshot, indent bool) error {
+	var b []byte
+	var err error
+	if indent {
+		b, err = json.MarshalIndent(newSnapshotDocument(s), "", "  ")
+	} else {
+		b, err = json.Marshal(newSnapshotDocument(s))
+	}
+	if err != nil {
+		return fmt.Errorf("could not encode snapshot: %s", err)
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+// statusOutput where status messages and logs are written.  With json stdout only
+// carries snapshot documents
+func statusOutput() *os.File {
+	if *format == formatJSON {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+func validFormat(format string) error {
+	if format != formatText && format != formatJSON {
+		return fmt.Errorf("invalid format \"%s\" expected text or json", format)
+	}
+	return nil
+}
+
+// MarshalText encodes the status by name
+func (c CheckStatus) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// UnmarshalText decodes a status written by MarshalText
+func (c *CheckStatus) UnmarshalText(b []byte) error {
+	for _, s := range []CheckStatus{CheckOK, CheckWarning, CheckCritical} {
+		if s.String() == string(b) {
+			*c = s
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid check status \"%s\"", b)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func TestWriteSnapshotJSONNonFinite(t *testing.T) {
+	tests := []struct {
+		name  string
+		value float64
+	}{
+		{"nan", math.NaN()},
+		{"positive infinity", math.Inf(1)},
+		{"negative infinity", math.Inf(-1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Snapshot{Start: time.Now(), Stop: time.Now(), Profile: "syslog-agent"}
+			s.Metric.Doppler.MessageRateCapacity = tt.value
+			s.Metric.DopplerInstance = []DopplerMetrics{{Name: "doppler/0", Ingress: tt.value}}
+
+			var buf bytes.Buffer
+			if err := writeSnapshotJSON(&buf, s, false); err != nil {
+				t.Fatalf("writeSnapshotJSON: %s", err)
+			}
+			var doc SnapshotDocument
+			if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+				t.Fatalf("could not decode document: %s", err)
+			}
+			if doc.Metrics.Doppler.MessageRateCapacity != 0 || doc.Metrics.DopplerInstance[0].Ingress != 0 {
+				t.Errorf("expected non finite values to be encoded as 0 got %v and %v",
+					doc.Metrics.Doppler.MessageRateCapacity, doc.Metrics.DopplerInstance[0].Ingress)
+			}
+			// the document works on copies
+			if v := s.Metric.DopplerInstance[0].Ingress; !math.IsNaN(v) && !math.IsInf(v, 0) {
+				t.Errorf("snapshot was modified, ingress is %v", v)
+			}
+		})
+	}
+}
+
+// TestSnapshotDocumentGolden the json field names of schema version 1.  A failure here
+// means the document changed, renaming or removing a field needs a new schema version
+func TestSnapshotDocumentGolden(t *testing.T) {
+	start := time.Date(2020, 1, 26, 10, 0, 0, 0, time.UTC)
+	system := InstanceMetrics{
+		Name: "doppler", Count: 2, CPUUser: 40, CPUSys: 5, CPUWait: 1, Memory: 60,
+		DiskSystem: 30, DiskEphemeral: 20, DiskPersistent: 10, Load1m: 0.5, Swap: 0,
+		NetBytesIn: 1024, NetBytesOut: 2048, NetErrors: 0,
+		CPUUserSpread: Spread{Mean: 40, Max: 50, Min: 30, StdDev: 10, Worst: "1/10.0.0.2"},
+		MemorySpread:  Spread{Mean: 60, Max: 61, Min: 59, StdDev: 1, Worst: "0/10.0.0.1"},
+	}
+	doppler := DopplerMetrics{
+		System: system, Name: "doppler/0", MessageRateCapacity: 750, Subscriptions: 4, Egress: 1400,
+		Ingress: 1500, IngressDropped: 12, Dropped: 1.5, DumpSinks: 2, SinksDropped: 0.5, SinkErrorsDropped: 0.25,
+	}
+	metron := MetronMetrics{
+		System: system, Name: "diego_cell/0", Ingress: 300, Egress: 299, Dropped: 1, AVGEnvelope: 512,
+		Deployment: "cf", Job: "diego_cell", Index: "0",
+	}
+	m := Metrics{
+		System:          []InstanceMetrics{system},
+		Doppler:         doppler,
+		TC:              TrafficControllerMetrics{System: system, SlowConsumers: 1, AppStreams: 3, Firehoses: 2, Egress: 800, Ingress: 900, ContainerLatency: LatencyQuantiles{P50: 5, P90: 20, P99: 80}},
+		RLP:             RLPMetrics{Egress: 100, Ingress: 101, Dropped: 1},
+		Metron:          metron,
+		Drain:           DrainMetrics{AgentBindings: 10, AgentIngress: 200, AgentEgress: 190, AgentDropped: 10, AgentInvalidDrains: 1, AgentActiveDrains: 9, AgentNonAppDrains: 2, AgentBlacklistedDrains: 0},
+		DopplerInstance: []DopplerMetrics{doppler},
+		DopplerSkew:     DopplerSkew{IngressCV: 0.1, SubscriptionCV: 0.2, Shares: []DopplerShare{{Name: "doppler/0", IngressShare: 1, SubscriptionShare: 1, IngressRatio: 1}}},
+		MetronInstance:  []MetronMetrics{metron},
+		SyslogAdapter:   SyslogAdapterMetrics{System: system, Bindings: 10, Ingress: 50, Egress: 49, Dropped: 1},
+		SyslogScheduler: SyslogSchedulerMetrics{System: system, Drains: 10},
+		LogCache:        []LogCacheMetrics{{Name: "log-cache/0", AvailableMemory: 1e9, TotalMemory: 4e9, Expired: 100, CachePeriod: 900000, NozzleErrors: 0}},
+		Apps:            []AppRate{{GUID: "6f3e", Name: "org/space/app", Rate: 150, Share: 0.75}},
+		Custom:          []CustomMetric{{Panel: "Doppler", Field: "doppler.custom", Label: "Custom", Unit: "/s", Value: 3}},
+		GroupBy:         "placement_tag",
+		Groups:          []GroupMetrics{{Name: "iso", Metric: Metrics{Doppler: DopplerMetrics{Ingress: 500}}}},
+		Trends: Trends{
+			Window:     time.Hour,
+			Doppler:    FlowTrends{Ingress: Trend{1400, 1500}, Egress: Trend{1300, 1400}, Dropped: Trend{1, 1.5}},
+			Metron:     FlowTrends{Ingress: Trend{300}, Egress: Trend{299}, Dropped: Trend{1}},
+			RLP:        FlowTrends{Ingress: Trend{101}, Egress: Trend{100}, Dropped: Trend{1}},
+			TCCPU:      Trend{20, 30},
+			DopplerCPU: Trend{40, 50},
+		},
+	}
+	s := &Snapshot{
+		Metric:           m,
+		Start:            start,
+		Stop:             start.Add(1500 * time.Millisecond),
+		Offset:           "2m",
+		Duration:         "5m",
+		Profile:          "syslog-agent",
+		ProfileReason:    "detected syslog_agent source id",
+		CollectionErrors: []error{errors.New(`sum(rate(egress{source_id="rlp"}[5m] offset 2m)): deadline exceeded`)},
+		Queries: []ExecutedQuery{
+			{Query: `sum(rate(ingress{source_id="doppler"}[5m] offset 2m))`, Duration: 20 * time.Millisecond},
+			{Query: `sum(rate(egress{source_id="rlp"}[5m] offset 2m))`, Duration: time.Second, Error: "deadline exceeded"},
+			{Query: `sum(rate(ingress{source_id="doppler"}[5m]))`, Range: true, Duration: 40 * time.Millisecond},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := writeSnapshotJSON(&buf, s, true); err != nil {
+		t.Fatal(err)
+	}
+	golden := filepath.Join("testdata", "snapshot.json")
+	if *updateGolden {
+		if err := ioutil.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("snapshot document does not match %s, run go test -run %s -update if the change is intended\n%s", golden, t.Name(), buf.Bytes())
+	}
+}
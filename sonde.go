@@ -0,0 +1,175 @@
+package main
+
+import (
+	"github.com/golang/protobuf/proto"
+)
+
+// The dropsonde protocol types below mirror the fields of sonde-go events.Envelope the
+// analyzer reads.  Only the license of sonde-go is vendored so the messages are declared
+// here with the same field numbers and decoded with the vendored protobuf library.
+// Log messages, http and container events are skipped when decoding.  Replace them with
+// github.com/cloudfoundry/sonde-go/events once its source is added through Godeps
+
+// EventType type of the event carried by an Envelope
+type EventType int32
+
+const (
+	EventTypeValueMetric  EventType = 6
+	EventTypeCounterEvent EventType = 7
+)
+
+var eventTypeValues = map[string]int32{
+	"HttpStartStop":   4,
+	"LogMessage":      5,
+	"ValueMetric":     6,
+	"CounterEvent":    7,
+	"Error":           8,
+	"ContainerMetric": 9,
+}
+
+// eventTypeEnum registry name of EventType used to parse text captures.  sonde-go
+// registers events.Envelope_EventType so a name of our own keeps the two from clashing
+const eventTypeEnum = "firehoseanalyzer.Envelope_EventType"
+
+func init() {
+	proto.RegisterEnum(eventTypeEnum, nil, eventTypeValues)
+}
+
+// Envelope dropsonde envelope as sent by the firehose
+type Envelope struct {
+	Origin       *string           `protobuf:"bytes,1,req,name=origin"`
+	EventType    *EventType        `protobuf:"varint,2,req,name=eventType,enum=firehoseanalyzer.Envelope_EventType"`
+	Timestamp    *int64            `protobuf:"varint,6,opt,name=timestamp"`
+	ValueMetric  *ValueMetric      `protobuf:"bytes,9,opt,name=valueMetric"`
+	CounterEvent *CounterEvent     `protobuf:"bytes,10,opt,name=counterEvent"`
+	Deployment   *string           `protobuf:"bytes,13,opt,name=deployment"`
+	Job          *string           `protobuf:"bytes,14,opt,name=job"`
+	Index        *string           `protobuf:"bytes,15,opt,name=index"`
+	Ip           *string           `protobuf:"bytes,16,opt,name=ip"`
+	Tags         map[string]string `protobuf:"bytes,17,rep,name=tags" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+}
+
+func (m *Envelope) Reset()         { *m = Envelope{} }
+func (m *Envelope) String() string { return proto.CompactTextString(m) }
+func (*Envelope) ProtoMessage()    {}
+
+// GetEventType returns the event type or 0 when not set
+func (m *Envelope) GetEventType() EventType {
+	if m != nil && m.EventType != nil {
+		return *m.EventType
+	}
+	return 0
+}
+
+// ValueMetric gauge value
+type ValueMetric struct {
+	Name  *string  `protobuf:"bytes,1,req,name=name"`
+	Value *float64 `protobuf:"fixed64,2,req,name=value"`
+	Unit  *string  `protobuf:"bytes,3,req,name=unit"`
+}
+
+func (m *ValueMetric) Reset()         { *m = ValueMetric{} }
+func (m *ValueMetric) String() string { return proto.CompactTextString(m) }
+func (*ValueMetric) ProtoMessage()    {}
+
+// CounterEvent counter increment and running total
+type CounterEvent struct {
+	Name  *string `protobuf:"bytes,1,req,name=name"`
+	Delta *uint64 `protobuf:"varint,2,req,name=delta"`
+	Total *uint64 `protobuf:"varint,3,opt,name=total"`
+}
+
+func (m *CounterEvent) Reset()         { *m = CounterEvent{} }
+func (m *CounterEvent) String() string { return proto.CompactTextString(m) }
+func (*CounterEvent) ProtoMessage()    {}
+
+func (m *Envelope) GetOrigin() string {
+	if m != nil && m.Origin != nil {
+		return *m.Origin
+	}
+	return ""
+}
+
+func (m *Envelope) GetTimestamp() int64 {
+	if m != nil && m.Timestamp != nil {
+		return *m.Timestamp
+	}
+	return 0
+}
+
+func (m *Envelope) GetValueMetric() *ValueMetric {
+	if m != nil {
+		return m.ValueMetric
+	}
+	return nil
+}
+
+func (m *Envelope) GetCounterEvent() *CounterEvent {
+	if m != nil {
+		return m.CounterEvent
+	}
+	return nil
+}
+
+func (m *Envelope) GetDeployment() string {
+	if m != nil && m.Deployment != nil {
+		return *m.Deployment
+	}
+	return ""
+}
+
+func (m *Envelope) GetJob() string {
+	if m != nil && m.Job != nil {
+		return *m.Job
+	}
+	return ""
+}
+
+func (m *Envelope) GetIndex() string {
+	if m != nil && m.Index != nil {
+		return *m.Index
+	}
+	return ""
+}
+
+func (m *Envelope) GetIp() string {
+	if m != nil && m.Ip != nil {
+		return *m.Ip
+	}
+	return ""
+}
+
+func (m *ValueMetric) GetName() string {
+	if m != nil && m.Name != nil {
+		return *m.Name
+	}
+	return ""
+}
+
+func (m *ValueMetric) GetValue() float64 {
+	if m != nil && m.Value != nil {
+		return *m.Value
+	}
+	return 0
+}
+
+func (m *CounterEvent) GetName() string {
+	if m != nil && m.Name != nil {
+		return *m.Name
+	}
+	return ""
+}
+
+func (m *CounterEvent) GetDelta() uint64 {
+	if m != nil && m.Delta != nil {
+		return *m.Delta
+	}
+	return 0
+}
+
+func (m *CounterEvent) GetTotal() uint64 {
+	if m != nil && m.Total != nil {
+		return *m.Total
+	}
+	return 0
+}
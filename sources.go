@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+var (
+	sourcesSortColumns = []string{"volume", "retention", "expired", "name"}
+	sourcesUsage       = `
+
+cf firehose-analyzer sources <options>
+
+Lists every source id held in log-cache
+
+Options
+-s <column>    - sort by volume, retention, expired or name, default is volume
+-n <count>     - number of sources to list, default is all` + transportUsage
+)
+
+// SourceInfo log-cache meta information for a single source id
+type SourceInfo struct {
+	SourceID string
+	App      string // org/space/app when the source id is an app guid
+	Count    int64
+	Expired  int64
+	Oldest   time.Time
+	Newest   time.Time
+}
+
+// Retention time between the oldest and newest envelope held for the source
+func (s SourceInfo) Retention() time.Duration {
+	return s.Newest.Sub(s.Oldest)
+}
+
+// Sources returns the meta information of every source id in log-cache
+func (lc *LCC) Sources() ([]SourceInfo, error) {
+	lc.checkToken()
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	meta, err := lc.client.Meta(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sources := make([]SourceInfo, 0, len(meta))
+	for id, m := range meta {
+		sources = append(sources, SourceInfo{
+			SourceID: id,
+			Count:    m.GetCount(),
+			Expired:  m.GetExpired(),
+			Oldest:   time.Unix(0, m.GetOldestTimestamp()),
+			Newest:   time.Unix(0, m.GetNewestTimestamp()),
+		})
+	}
+	return sources, nil
+}
+
+// resolveSourceApps fills in org/space/app for sources that are app guids
+func resolveSourceApps(sources []SourceInfo, r *appResolver) error {
+	guids := make([]string, 0, len(sources))
+	for i := range sources {
+		guids = append(guids, sources[i].SourceID)
+	}
+	err := r.Resolve(guids)
+	for i := range sources {
+		if a, ok := r.Lookup(sources[i].SourceID); ok {
+			sources[i].App = a.String()
+		}
+	}
+	return err
+}
+
+// sortSources sorts by name ascending or by the given column descending
+func sortSources(sources []SourceInfo, column string) {
+	sort.SliceStable(sources, func(i, j int) bool {
+		a, b := sources[i], sources[j]
+		switch column {
+		case "name":
+			return a.SourceID < b.SourceID
+		case "retention":
+			if a.Retention() != b.Retention() {
+				return a.Retention() > b.Retention()
+			}
+		case "expired":
+			if a.Expired != b.Expired {
+				return a.Expired > b.Expired
+			}
+		default:
+			if a.Count != b.Count {
+				return a.Count > b.Count
+			}
+		}
+		return a.SourceID < b.SourceID
+	})
+}
+
+func startSources(args []string) {
+	fs := flag.NewFlagSet("firehose-sources-args", flag.ExitOnError)
+	sortColumn := fs.String("s", "volume", "Specify sort column")
+	limit := fs.Int("n", 0, "Specify number of sources to list")
+	addTransportFlags(fs)
+	fs.Usage = func() { fmt.Println(sourcesUsage) }
+	err := fs.Parse(args)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err := validSortColumn(*sortColumn, sourcesSortColumns); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	lcc, err := newLogCacheClient(1, queryTimeout)
+	if err != nil {
+		fatalf("Could not create log cache client: %s\n", err)
+	}
+	sources, err := lcc.Sources()
+	if err != nil {
+		fatalf("Could not read log cache meta: %s\n", err)
+	}
+	if err := resolveSourceApps(sources, newAppResolver()); err != nil {
+		fmt.Printf("Could not resolve all app names: %s\n", err)
+	}
+	sortSources(sources, *sortColumn)
+	// the share is of every source not just the ones listed
+	total := sourcesTotal(sources)
+	if *limit > 0 && *limit < len(sources) {
+		sources = sources[:*limit]
+	}
+	printSources(os.Stdout, sources, total)
+}
+
+// sourcesTotal number of envelopes held for all sources
+func sourcesTotal(sources []SourceInfo) int64 {
+	var total int64
+	for _, s := range sources {
+		total += s.Count
+	}
+	return total
+}
+
+// sourceShare percentage of total held for a source, "-" when log-cache is empty
+func sourceShare(count, total int64) string {
+	if total <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", float64(count)/float64(total)*100)
+}
+
+func printSources(out io.Writer, sources []SourceInfo, total int64) {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "Source ID\tApp\tEnvelopes\tShare\tExpired\tOldest\tNewest\tRetention")
+	for _, s := range sources {
+		app := s.App
+		if app == "" {
+			app = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%d\t%s\t%s\t%s\n", s.SourceID,
+			app,
+			s.Count,
+			sourceShare(s.Count, total),
+			s.Expired,
+			s.Oldest.Format(time.RFC3339),
+			s.Newest.Format(time.RFC3339),
+			s.Retention().Round(time.Second))
+	}
+	w.Flush()
+}
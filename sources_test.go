@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSourceShare(t *testing.T) {
+	tests := []struct {
+		count, total int64
+		want         string
+	}{
+		{count: 25, total: 100, want: "25.0%"},
+		{count: 1, total: 3, want: "33.3%"},
+		{count: 0, total: 100, want: "0.0%"},
+		{count: 0, total: 0, want: "-"},
+	}
+	for _, tt := range tests {
+		if got := sourceShare(tt.count, tt.total); got != tt.want {
+			t.Errorf("%d of %d: expected %s got %s", tt.count, tt.total, tt.want, got)
+		}
+	}
+}
+
+func TestPrintSourcesShareOfAllSources(t *testing.T) {
+	sources := []SourceInfo{
+		{SourceID: "doppler", Count: 600},
+		{SourceID: "gorouter", Count: 300},
+		{SourceID: "uaa", Count: 100},
+	}
+	tests := []struct {
+		name    string
+		sources []SourceInfo
+		total   int64
+		want    []string
+	}{
+		{name: "every source", sources: sources, total: sourcesTotal(sources), want: []string{"60.0%", "30.0%", "10.0%"}},
+		{name: "limited", sources: sources[:2], total: sourcesTotal(sources), want: []string{"60.0%", "30.0%"}},
+		{name: "empty log-cache", sources: []SourceInfo{{SourceID: "doppler"}}, want: []string{"-"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			printSources(&buf, tt.sources, tt.total)
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")[1:]
+			if len(lines) != len(tt.want) {
+				t.Fatalf("expected %d rows got %q", len(tt.want), lines)
+			}
+			for i, want := range tt.want {
+				if fields := strings.Fields(lines[i]); fields[3] != want {
+					t.Errorf("row %d: expected share %s got %q", i, want, lines[i])
+				}
+			}
+		})
+	}
+}
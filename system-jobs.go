@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	diskPressureWarn = 80.0 // percent
+	diskPressureCrit = 90.0 // percent
+)
+
+// vmHealthJobs jobs where disk pressure and swap use usually explain drops
+var vmHealthJobs = map[string]bool{
+	dopplerJob:  true,
+	"log-cache": true,
+}
+
+// collectSystemJobs schedules the system metric queries for every job reported by the
+// bosh system metrics forwarder.  Results are stored in jobs keyed by job name
+func (lc *LCC) collectSystemJobs(p *queryPool, jobs map[string]*InstanceMetrics) {
+	get := func(name string) *InstanceMetrics {
+		j, ok := jobs[name]
+		if !ok {
+			j = &InstanceMetrics{Name: name}
+			jobs[name] = j
+		}
+		return j
+	}
+	lc.grouped(p, "job", cpuUserGauge, boshSystemMetricsSID, "", querySystemCountBy, func(n string, v float64) { get(n).Count = int64(v) })
+	lc.grouped(p, "job", cpuUserGauge, boshSystemMetricsSID, "", querySystemAvgOverTimeBy, func(n string, v float64) { get(n).CPUUser = v })
+	lc.grouped(p, "job", cpuSYSGauge, boshSystemMetricsSID, "", querySystemAvgOverTimeBy, func(n string, v float64) { get(n).CPUSys = v })
+	lc.grouped(p, "job", cpuWaitGauge, boshSystemMetricsSID, "", querySystemAvgOverTimeBy, func(n string, v float64) { get(n).CPUWait = v })
+	lc.grouped(p, "job", memoryPercentGauge, boshSystemMetricsSID, "", querySystemAvgOverTimeBy, func(n string, v float64) { get(n).Memory = v })
+
+	lc.grouped(p, "job", diskSystemGauge, boshSystemMetricsSID, "", querySystemMaxBy, func(n string, v float64) { get(n).DiskSystem = v })
+	lc.grouped(p, "job", diskEphemeralGauge, boshSystemMetricsSID, "", querySystemMaxBy, func(n string, v float64) { get(n).DiskEphemeral = v })
+	lc.grouped(p, "job", diskPersistentGauge, boshSystemMetricsSID, "", querySystemMaxBy, func(n string, v float64) { get(n).DiskPersistent = v })
+	lc.grouped(p, "job", load1mGauge, boshSystemMetricsSID, "", querySystemAvgBy, func(n string, v float64) { get(n).Load1m = v })
+	lc.grouped(p, "job", swapPercentGauge, boshSystemMetricsSID, "", querySystemMaxBy, func(n string, v float64) { get(n).Swap = v })
+	lc.grouped(p, "job", netBytesInCounter, boshSystemMetricsSID, "", querySystemSumRateBy, func(n string, v float64) { get(n).NetBytesIn = v })
+	lc.grouped(p, "job", netBytesOutCounter, boshSystemMetricsSID, "", querySystemSumRateBy, func(n string, v float64) { get(n).NetBytesOut = v })
+	lc.grouped(p, "job", netErrorsInCounter, boshSystemMetricsSID, "", querySystemSumRateBy, func(n string, v float64) { get(n).NetErrors += v })
+	lc.grouped(p, "job", netErrorsOutCounter, boshSystemMetricsSID, "", querySystemSumRateBy, func(n string, v float64) { get(n).NetErrors += v })
+}
+
+// HealthWarnings disk pressure and swap use on doppler and log-cache vms.  critical is
+// true when any disk is above diskPressureCrit
+func (i InstanceMetrics) HealthWarnings() (warnings []string, critical bool) {
+	if !vmHealthJobs[i.Name] {
+		return nil, false
+	}
+	disks := []struct {
+		name    string
+		percent float64
+	}{
+		{"system disk", i.DiskSystem},
+		{"ephemeral disk", i.DiskEphemeral},
+		{"persistent disk", i.DiskPersistent},
+	}
+	for _, d := range disks {
+		if d.percent >= diskPressureWarn {
+			warnings = append(warnings, fmt.Sprintf("%s %s at %.0f%%", i.Name, d.name, d.percent))
+			critical = critical || d.percent >= diskPressureCrit
+		}
+	}
+	if i.Swap > 0 {
+		warnings = append(warnings, fmt.Sprintf("%s swap in use at %.1f%%", i.Name, i.Swap))
+	}
+	return warnings, critical
+}
+
+// systemJobList flattens the job map into a slice sorted by name keeping only the jobs
+// in filter.  An empty filter keeps every job
+func systemJobList(jobs map[string]*InstanceMetrics, filter []string) []InstanceMetrics {
+	keep := make(map[string]bool)
+	for _, f := range filter {
+		keep[f] = true
+	}
+	l := make([]InstanceMetrics, 0, len(jobs))
+	for _, j := range jobs {
+		if len(keep) > 0 && !keep[j.Name] {
+			continue
+		}
+		j.CPUUserSpread = spread(j.cpuSamples)
+		j.MemorySpread = spread(j.memorySamples)
+		l = append(l, *j)
+	}
+	sort.SliceStable(l, func(i, j int) bool { return l[i].Name < l[j].Name })
+	return l
+}
+
+// parseJobFilter splits a comma separated list of job names
+func parseJobFilter(jobs string) []string {
+	filter := make([]string, 0)
+	for _, j := range strings.Split(jobs, ",") {
+		if j = strings.TrimSpace(j); j != "" {
+			filter = append(filter, j)
+		}
+	}
+	return filter
+}
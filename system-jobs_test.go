@@ -0,0 +1,108 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"code.cloudfoundry.org/log-cache/pkg/rpc/logcache_v1"
+)
+
+func TestInstanceRowsJobFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  string
+		system  []InstanceMetrics
+		want    string
+		notWant string
+	}{
+		{name: "jobs", filter: "doppler", system: []InstanceMetrics{{Name: "doppler", Count: 2}}, want: "doppler", notWant: "no jobs match"},
+		{name: "no match", filter: "dopler, log-cache", want: "no jobs match --jobs dopler,log-cache", notWant: "Traffic Controller"},
+		{name: "no jobs discovered", want: "Traffic Controller", notWant: "no jobs match"},
+	}
+	defer func(f string) { *jobFilter = f }(*jobFilter)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*jobFilter = tt.filter
+			got := instanceRows(&Snapshot{Profile: "syslog-agent", Metric: Metrics{System: tt.system}})
+			if !strings.Contains(got, tt.want) || strings.Contains(got, tt.notWant) {
+				t.Errorf("expected %q without %q got %q", tt.want, tt.notWant, got)
+			}
+		})
+	}
+}
+
+func TestHealthWarnings(t *testing.T) {
+	tests := []struct {
+		name     string
+		job      InstanceMetrics
+		warnings []string
+		critical bool
+	}{
+		{name: "healthy", job: InstanceMetrics{Name: "doppler", DiskSystem: 40, DiskEphemeral: 79}},
+		{name: "disk pressure", job: InstanceMetrics{Name: "doppler", DiskEphemeral: 85}, warnings: []string{"doppler ephemeral disk at 85%"}},
+		{
+			name:     "full disk and swap",
+			job:      InstanceMetrics{Name: "log-cache", DiskSystem: 80, DiskPersistent: 95, Swap: 2.5},
+			warnings: []string{"log-cache system disk at 80%", "log-cache persistent disk at 95%", "log-cache swap in use at 2.5%"},
+			critical: true,
+		},
+		// only dopplers and log-cache nodes are checked
+		{name: "other job", job: InstanceMetrics{Name: "diego_cell", DiskEphemeral: 99, Swap: 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings, critical := tt.job.HealthWarnings()
+			if !reflect.DeepEqual(warnings, tt.warnings) || critical != tt.critical {
+				t.Errorf("HealthWarnings() = %v %v, expected %v %v", warnings, critical, tt.warnings, tt.critical)
+			}
+		})
+	}
+}
+
+func TestCollectSystemJobsVMHealth(t *testing.T) {
+	updateQeries("2m", "5m", "index")
+	byJob := func(doppler, cell float64) []*logcache_v1.PromQL_Sample {
+		return []*logcache_v1.PromQL_Sample{promSample(doppler, "job", "doppler"), promSample(cell, "job", "diego_cell")}
+	}
+	results := map[string][]*logcache_v1.PromQL_Sample{
+		formatQuery(diskSystemGauge, boshSystemMetricsSID, "", querySystemMaxBy):         byJob(30, 40),
+		formatQuery(diskEphemeralGauge, boshSystemMetricsSID, "", querySystemMaxBy):      byJob(92, 50),
+		formatQuery(diskPersistentGauge, boshSystemMetricsSID, "", querySystemMaxBy):     byJob(0, 10),
+		formatQuery(load1mGauge, boshSystemMetricsSID, "", querySystemAvgBy):             byJob(1.5, 4),
+		formatQuery(swapPercentGauge, boshSystemMetricsSID, "", querySystemMaxBy):        byJob(0, 3),
+		formatQuery(netBytesInCounter, boshSystemMetricsSID, "", querySystemSumRateBy):   byJob(2048, 1024),
+		formatQuery(netBytesOutCounter, boshSystemMetricsSID, "", querySystemSumRateBy):  byJob(4096, 512),
+		formatQuery(netErrorsInCounter, boshSystemMetricsSID, "", querySystemSumRateBy):  byJob(1, 0),
+		formatQuery(netErrorsOutCounter, boshSystemMetricsSID, "", querySystemSumRateBy): byJob(0.5, 0),
+	}
+	jobs := make(map[string]*InstanceMetrics)
+	errs := runCollector(t, results, func(lc *LCC, p *queryPool) { lc.collectSystemJobs(p, jobs) })
+	// the cpu and memory queries have no results
+	if len(errs) != 5 {
+		t.Errorf("expected the 5 cpu and memory queries to fail got %v", errs)
+	}
+	l := systemJobList(jobs, nil)
+	if len(l) != 2 || l[0].Name != "diego_cell" || l[1].Name != "doppler" {
+		t.Fatalf("expected the diego_cell and doppler jobs got %+v", l)
+	}
+	d := l[1]
+	if d.DiskSystem != 30 || d.DiskEphemeral != 92 || d.Load1m != 1.5 || d.NetBytesIn != 2048 || d.NetBytesOut != 4096 || d.NetErrors != 1.5 {
+		t.Errorf("unexpected doppler vm health %+v", d)
+	}
+
+	stats := vmHealthStats(l)
+	if !strings.Contains(stats, "WARNING: doppler ephemeral disk at 92%") || strings.Contains(stats, "diego_cell swap") {
+		t.Errorf("expected only the doppler disk to be flagged in %q", stats)
+	}
+	var vmCheck *Check
+	checks := evaluateChecks(&Snapshot{Profile: "syslog-agent", Metric: Metrics{System: l}})
+	for i := range checks {
+		if checks[i].Name == "doppler vm health" {
+			vmCheck = &checks[i]
+		}
+	}
+	if vmCheck == nil || vmCheck.Status != CheckCritical {
+		t.Errorf("expected a critical doppler vm health check got %+v", vmCheck)
+	}
+}
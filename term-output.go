@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	tm "github.com/buger/goterm"
@@ -9,99 +10,438 @@ import (
 
 var screenTemplate = `
 Welcome to Firehose Analyzer - %s
-Selected duration=%s and offset=%s
+Selected duration=%s and offset=%s profile=%s (%s)
+Collected at %s (%s old, took %s) %s
 
-Job                    Instance-Counts     CPU-User     CPU-Sys     CPU-Wait      Memory
-----------------------------------------------------------------------------------------
-Traffic Controller   %3d                   %5.2f        %5.2f       %5.2f         %5.2f
-Doppler              %3d                   %5.2f        %5.2f       %5.2f         %5.2f
+Job                    Instance-Counts     CPU-User     CPU-Sys     CPU-Wait      Memory    CPU-User(min/max/sd)     Busiest
+----------------------------------------------------------------------------------------------------------------------------------
+%s
+%s
+Traffic Controller Information:
+Firehose Subscriptions          : %.0f
+App Streams                     : %.0f
+Slow Consumers/s                : %.2f
+Ingress/s                       : %.0f
+Egress/s                        : %.0f
+Container Metrics Latency       : p50=%.0fms p90=%.0fms p99=%.0fms
 
 Drain Information:
-Syslog Agent drain bindings     : %.0f
-Syslog Agent Active Drains      : %.0f
-Syslog Agent Invalid Drains     : %.0f
-Syslog Agent Non-App Drains     : %.0f
-Syslog Agent Blacklisted Drains : %.0f
-
+%s
 Doppler Ingress Max Dropped    : %.0f
 Doppler Message Rate Capcity   : ` + tm.Color("%.2f", tm.YELLOW) + `
 
 %s
 
+%s
+
+%s
+
+%s
+
+%s
+
+%s
+
+%s
+
+%s
 
 %s
 `
 
-func updateTerm(lcc *LCC) {
-	lcc.Lock()
-	defer lcc.Unlock()
+// snapshotSource provides the snapshots shown by the terminal ui
+type snapshotSource interface {
+	Snapshot() *Snapshot
+	Collecting() bool
+}
 
+func updateTerm(lcc snapshotSource) {
 	tm.Clear()
 	tm.MoveCursor(1, 1)
 
+	s := lcc.Snapshot()
+	if s == nil {
+		tm.Printf("\nWelcome to Firehose Analyzer - %s\nWaiting for the first collection to complete...\n", time.Now().Format(time.UnixDate))
+		tm.Flush()
+		return
+	}
+
+	var refreshing string
+	if lcc.Collecting() {
+		refreshing = tm.Color("[refresh in progress]", tm.YELLOW)
+	}
+	tm.Print(renderReport(s, s.ProfileReason, refreshing))
+	//tm.Printf("%v\n", mc)
+	tm.Flush()
+}
+
+// renderReport formats a snapshot using the screen template
+func renderReport(s *Snapshot, profileReason, refreshing string) string {
 	// check for errors and populate error string
 	var collectionErrors string
-	if len(lcc.CollectionErrors) > 0 {
+	if len(s.CollectionErrors) > 0 {
 		collectionErrors = "Errors Found during Collection (Max 3 Errors displayed):\n"
 		var maxErrors int
-		if len(lcc.CollectionErrors) > 3 {
+		if len(s.CollectionErrors) > 3 {
 			maxErrors = 3
 		} else {
-			maxErrors = len(lcc.CollectionErrors)
+			maxErrors = len(s.CollectionErrors)
 		}
 		for i := 0; i < maxErrors; i++ {
-			collectionErrors += fmt.Sprintf("%s\n", lcc.CollectionErrors[i].Error())
+			collectionErrors += fmt.Sprintf("%s\n", s.CollectionErrors[i].Error())
 		}
 	}
 
 	envStats := "Job\t\tSubscriptions\tIngress/s\tEgress/s\tDropped/s\tLoss\n"
 	envStats += "----------------------------------------------------------------------------------------\n"
-	envStats += fmt.Sprintf("Doppler\t\t%.0f\t\t%.0f\t\t%.0f\t\t%.0f\t\t%.2f\n", lcc.Metric.Doppler.Subscriptions,
-		lcc.Metric.Doppler.Ingress,
-		lcc.Metric.Doppler.Egress,
-		lcc.Metric.Doppler.Dropped,
-		float64(lcc.Metric.Doppler.Dropped)/float64(lcc.Metric.Doppler.Ingress))
-	envStats += fmt.Sprintf("Metron\t\tN/A\t\t%.0f\t\t%.0f\t\t%.0f\t\t%.2f\n", lcc.Metric.Metron.Ingress,
-		lcc.Metric.Metron.Egress,
-		lcc.Metric.Metron.Dropped,
-		float64(lcc.Metric.Metron.Dropped)/float64(lcc.Metric.Metron.Ingress))
-	envStats += fmt.Sprintf("RLP\t\tN/A\t\t%.0f\t\t%.0f\t\t%.0f\t\t%.2f\n", lcc.Metric.RLP.Ingress,
-		lcc.Metric.RLP.Egress,
-		lcc.Metric.RLP.Dropped,
-		float64(lcc.Metric.RLP.Dropped)/float64(lcc.Metric.RLP.Ingress))
-	envStats += fmt.Sprintf("Syslog Agent\tN/A\t\t%.0f\t\t%.0f\t\t%.0f\t\t%.2f\n", lcc.Metric.Drain.AgentIngress,
-		lcc.Metric.Drain.AgentEgress,
-		lcc.Metric.Drain.AgentDropped,
-		float64(lcc.Metric.Drain.AgentDropped)/float64(lcc.Metric.Drain.AgentIngress)) // syslog agent loss rate
-
-	tm.Printf(screenTemplate,
+	envStats += fmt.Sprintf("Doppler\t\t%.0f\t\t%.0f\t\t%.0f\t\t%.0f\t\t%.2f\n", s.Metric.Doppler.Subscriptions,
+		s.Metric.Doppler.Ingress,
+		s.Metric.Doppler.Egress,
+		s.Metric.Doppler.Dropped,
+		s.Metric.Doppler.IngressLoss())
+	envStats += fmt.Sprintf("Doppler Sinks\t%.0f\t\tN/A\t\tN/A\t\t%.0f\t\t%.2f\t(sinks dropped %.0f/s, sink errors dropped %.0f/s)\n", s.Metric.Doppler.DumpSinks,
+		s.Metric.Doppler.SinksDropped+s.Metric.Doppler.SinkErrorsDropped,
+		s.Metric.Doppler.SinkLoss(),
+		s.Metric.Doppler.SinksDropped,
+		s.Metric.Doppler.SinkErrorsDropped)
+	envStats += fmt.Sprintf("Metron\t\tN/A\t\t%.0f\t\t%.0f\t\t%.0f\t\t%.2f\n", s.Metric.Metron.Ingress,
+		s.Metric.Metron.Egress,
+		s.Metric.Metron.Dropped,
+		float64(s.Metric.Metron.Dropped)/float64(s.Metric.Metron.Ingress))
+	envStats += fmt.Sprintf("RLP\t\tN/A\t\t%.0f\t\t%.0f\t\t%.0f\t\t%.2f\n", s.Metric.RLP.Ingress,
+		s.Metric.RLP.Egress,
+		s.Metric.RLP.Dropped,
+		float64(s.Metric.RLP.Dropped)/float64(s.Metric.RLP.Ingress))
+	if queryProfiles[s.Profile].SyslogAdapter {
+		envStats += fmt.Sprintf("Syslog Adapter\tN/A\t\t%.0f\t\t%.0f\t\t%.0f\t\t%.2f\n", s.Metric.SyslogAdapter.Ingress,
+			s.Metric.SyslogAdapter.Egress,
+			s.Metric.SyslogAdapter.Dropped,
+			float64(s.Metric.SyslogAdapter.Dropped)/float64(s.Metric.SyslogAdapter.Ingress)) // syslog adapter loss rate
+	} else {
+		envStats += fmt.Sprintf("Syslog Agent\tN/A\t\t%.0f\t\t%.0f\t\t%.0f\t\t%.2f\n", s.Metric.Drain.AgentIngress,
+			s.Metric.Drain.AgentEgress,
+			s.Metric.Drain.AgentDropped,
+			float64(s.Metric.Drain.AgentDropped)/float64(s.Metric.Drain.AgentIngress)) // syslog agent loss rate
+	}
+
+	return fmt.Sprintf(screenTemplate,
 		time.Now().Format(time.UnixDate),
-		*sampleDuration,
-		*sampleOffset,
-		lcc.Metric.TC.System.Count,
-		lcc.Metric.TC.System.CPUUser,
-		lcc.Metric.TC.System.CPUSys,
-		lcc.Metric.TC.System.CPUWait,
-		lcc.Metric.TC.System.Memory,
-		lcc.Metric.Doppler.System.Count,
-		lcc.Metric.Doppler.System.CPUUser,
-		lcc.Metric.Doppler.System.CPUSys,
-		lcc.Metric.Doppler.System.CPUWait,
-		lcc.Metric.Doppler.System.Memory,
-		lcc.Metric.Drain.AgentBindings,
-		lcc.Metric.Drain.AgentActiveDrains,
-		lcc.Metric.Drain.AgentInvalidDrains,
-		lcc.Metric.Drain.AgentNonAppDrains,
-		lcc.Metric.Drain.AgentBlacklistedDrains,
-		lcc.Metric.Doppler.IngressDropped,
-		lcc.Metric.Doppler.MessageRateCapacity,
-		envStats,
+		s.Duration,
+		s.Offset,
+		s.Profile,
+		profileReason,
+		s.Stop.Format(time.UnixDate),
+		s.Age().Round(time.Second),
+		s.Elapsed().Round(time.Millisecond),
+		refreshing,
+		instanceRows(s),
+		vmHealthStats(s.Metric.System),
+		s.Metric.TC.Firehoses,
+		s.Metric.TC.AppStreams,
+		s.Metric.TC.SlowConsumers,
+		s.Metric.TC.Ingress,
+		s.Metric.TC.Egress,
+		s.Metric.TC.ContainerLatency.P50,
+		s.Metric.TC.ContainerLatency.P90,
+		s.Metric.TC.ContainerLatency.P99,
+		drainStats(s),
+		s.Metric.Doppler.IngressDropped,
+		s.Metric.Doppler.MessageRateCapacity,
+		envStats+groupStats(s),
+		trendStats(s.Metric.Trends),
+		dopplerInstanceStats(s.Metric.DopplerInstance),
+		dopplerSkewStats(s.Metric.DopplerSkew),
+		metronDropperStats(s.Metric.MetronInstance),
+		logCacheStats(s.Metric.LogCache),
+		appStats(s),
+		customStats(s.Metric.Custom),
 		collectionErrors)
-	//tm.Printf("%v\n", mc)
-	tm.Flush()
 }
 
-func loopTerm(lcc *LCC) {
+// drainStats renders drain counts for the syslog agent or the deprecated syslog adapter
+func drainStats(s *Snapshot) string {
+	if queryProfiles[s.Profile].SyslogAdapter {
+		return fmt.Sprintf(`Syslog Adapter drain bindings   : %.0f
+Syslog Scheduler drains         : %.0f
+`, s.Metric.SyslogAdapter.Bindings,
+			s.Metric.SyslogScheduler.Drains)
+	}
+	return fmt.Sprintf(`Syslog Agent drain bindings     : %.0f
+Syslog Agent Active Drains      : %.0f
+Syslog Agent Invalid Drains     : %.0f
+Syslog Agent Non-App Drains     : %.0f
+Syslog Agent Blacklisted Drains : %.0f
+`, s.Metric.Drain.AgentBindings,
+		s.Metric.Drain.AgentActiveDrains,
+		s.Metric.Drain.AgentInvalidDrains,
+		s.Metric.Drain.AgentNonAppDrains,
+		s.Metric.Drain.AgentBlacklistedDrains)
+}
+
+// vmHealthStats renders disk, load, swap and network for every discovered job and
+// highlights disk pressure and swap use on doppler and log-cache vms
+func vmHealthStats(jobs []InstanceMetrics) string {
+	if len(jobs) == 0 {
+		return ""
+	}
+	stats := "VM Health (disk and swap are the max across instances)\n"
+	stats += fmt.Sprintf("%-28s%-12s%-12s%-12s%-10s%-10s%-12s%-12s%s\n", "Job", "Disk-Sys", "Disk-Eph", "Disk-Pers", "Load-1m", "Swap", "Net-In/s", "Net-Out/s", "Net-Err/s")
+	stats += "------------------------------------------------------------------------------------------------------------------------------------\n"
+	var warnings []string
+	for _, j := range jobs {
+		row := fmt.Sprintf("%-28s%-12s%-12s%-12s%-10.2f%-10s%-12s%-12s%.2f", j.Name,
+			fmt.Sprintf("%.0f%%", j.DiskSystem),
+			fmt.Sprintf("%.0f%%", j.DiskEphemeral),
+			fmt.Sprintf("%.0f%%", j.DiskPersistent),
+			j.Load1m,
+			fmt.Sprintf("%.1f%%", j.Swap),
+			formatBytes(j.NetBytesIn),
+			formatBytes(j.NetBytesOut),
+			j.NetErrors)
+		w, critical := j.HealthWarnings()
+		switch {
+		case critical:
+			row = tm.Color(row, tm.RED)
+		case len(w) > 0:
+			row = tm.Color(row, tm.YELLOW)
+		}
+		warnings = append(warnings, w...)
+		stats += row + "\n"
+	}
+	for _, w := range warnings {
+		stats += tm.Color("WARNING: "+w, tm.YELLOW) + "\n"
+	}
+	return stats
+}
+
+// instanceRows system metric rows for every discovered job.  Falls back to the
+// traffic controller, doppler and syslog adapter panels when no jobs were discovered
+// and --jobs is not set
+func instanceRows(s *Snapshot) string {
+	var rows string
+	if len(s.Metric.System) > 0 {
+		for _, j := range s.Metric.System {
+			rows += instanceRow(j.Name, j)
+		}
+		return rows
+	}
+	if filter := parseJobFilter(*jobFilter); len(filter) > 0 {
+		return tm.Color(fmt.Sprintf("no jobs match --jobs %s", strings.Join(filter, ",")), tm.YELLOW) + "\n"
+	}
+	rows = instanceRow("Traffic Controller", s.Metric.TC.System) + instanceRow("Doppler", s.Metric.Doppler.System)
+	if queryProfiles[s.Profile].SyslogAdapter {
+		rows += instanceRow("Syslog Adapter", s.Metric.SyslogAdapter.System) +
+			instanceRow("Syslog Scheduler", s.Metric.SyslogScheduler.System)
+	}
+	return rows
+}
+
+// instanceRow formats system metrics to line up with the instance table.  Jobs with
+// one instance running well above the average are marked and highlighted
+func instanceRow(name string, i InstanceMetrics) string {
+	row := fmt.Sprintf("%-20s %3d                   %5.2f%-1s       %5.2f       %5.2f         %5.2f%-1s", name,
+		i.Count,
+		i.CPUUser,
+		i.CPUUserSpread.Indicator(),
+		i.CPUSys,
+		i.CPUWait,
+		i.Memory,
+		i.MemorySpread.Indicator())
+	if i.CPUUserSpread.Worst != "" {
+		row += fmt.Sprintf("    %-25s%s", fmt.Sprintf("%.2f/%.2f/%.2f", i.CPUUserSpread.Min, i.CPUUserSpread.Max, i.CPUUserSpread.StdDev), i.CPUUserSpread.Worst)
+	}
+	if i.CPUUserSpread.Imbalanced() || i.MemorySpread.Imbalanced() {
+		row = tm.Color(row, tm.YELLOW)
+	}
+	return row + "\n"
+}
+
+// groupStats renders the doppler, metron, rlp and syslog rows for every group
+func groupStats(s *Snapshot) string {
+	if s.Metric.GroupBy == "" {
+		return ""
+	}
+	adapter := queryProfiles[s.Profile].SyslogAdapter
+	stats := fmt.Sprintf("\nGrouped by %s\n", s.Metric.GroupBy)
+	stats += "Group\t\t\t\tJob\t\tInstances\tSubscriptions\tIngress/s\tEgress/s\tDropped/s\tLoss\n"
+	stats += "------------------------------------------------------------------------------------------------------------------------------------\n"
+	row := func(group, job, instances, subscriptions string, ingress, egress, dropped float64) string {
+		if ingress == 0 && egress == 0 && dropped == 0 {
+			return ""
+		}
+		return fmt.Sprintf("%-32s%-16s%-16s%-16s%-16.0f%-16.0f%-16.0f%.2f\n", group, job, instances, subscriptions, ingress, egress, dropped, dropped/ingress)
+	}
+	for _, g := range s.Metric.Groups {
+		m := g.Metric
+		name := g.Name
+		if name == "" {
+			name = "(none)"
+		}
+		stats += row(name, "Doppler", fmt.Sprintf("%d", m.Doppler.System.Count), fmt.Sprintf("%.0f", m.Doppler.Subscriptions), m.Doppler.Ingress, m.Doppler.Egress, m.Doppler.Dropped)
+		stats += row(name, "Metron", "N/A", "N/A", m.Metron.Ingress, m.Metron.Egress, m.Metron.Dropped)
+		stats += row(name, "RLP", "N/A", "N/A", m.RLP.Ingress, m.RLP.Egress, m.RLP.Dropped)
+		if adapter {
+			stats += row(name, "Syslog Adapter", fmt.Sprintf("%d", m.SyslogAdapter.System.Count), "N/A", m.SyslogAdapter.Ingress, m.SyslogAdapter.Egress, m.SyslogAdapter.Dropped)
+		} else {
+			stats += row(name, "Syslog Agent", "N/A", "N/A", m.Drain.AgentIngress, m.Drain.AgentEgress, m.Drain.AgentDropped)
+		}
+	}
+	return stats
+}
+
+// trendStats renders sparklines of the headline metrics over the trend window
+func trendStats(t Trends) string {
+	if t.Window == 0 {
+		return ""
+	}
+	stats := fmt.Sprintf("Trends over the last %s\n", t.Window)
+	stats += fmt.Sprintf("%-16s%-32s%-32s%s\n", "Job", "Ingress/s", "Egress/s", "Dropped/s")
+	stats += "------------------------------------------------------------------------------------------------------------------------------------\n"
+	flow := func(name string, f FlowTrends) string {
+		return fmt.Sprintf("%-16s%-32s%-32s%s\n", name, f.Ingress.Sparkline(), f.Egress.Sparkline(), f.Dropped.Sparkline())
+	}
+	stats += flow("Doppler", t.Doppler)
+	stats += flow("Metron", t.Metron)
+	stats += flow("RLP", t.RLP)
+	stats += fmt.Sprintf("%-16s%-32s\n", "TC CPU-User", t.TCCPU.Sparkline())
+	stats += fmt.Sprintf("%-16s%-32s\n", "Doppler CPU-User", t.DopplerCPU.Sparkline())
+	return stats
+}
+
+// dopplerInstanceStats renders the per doppler table sorted by the selected column
+func dopplerInstanceStats(instances []DopplerMetrics) string {
+	d := make([]DopplerMetrics, len(instances))
+	copy(d, instances)
+	sortDopplerInstances(d, *dopplerSort)
+
+	stats := fmt.Sprintf("Doppler Instances (%s, sorted by %s)\n", *instanceLabel, *dopplerSort)
+	stats += "Instance\t\t\t\t\tSubscriptions\tIngress/s\tEgress/s\tDropped/s\tIngress-Dropped/s\tLoss\tDump-Sinks\tSink-Dropped/s\tSink-Loss\n"
+	stats += "------------------------------------------------------------------------------------------------------------------------------------\n"
+	for _, i := range d {
+		stats += fmt.Sprintf("%-40s\t%.0f\t\t%.0f\t\t%.0f\t\t%.0f\t\t%.0f\t\t\t%.2f\t%.0f\t\t%.0f\t\t%.2f\n", i.Name,
+			i.Subscriptions,
+			i.Ingress,
+			i.Egress,
+			i.Dropped,
+			i.IngressDropped,
+			i.IngressLoss(),
+			i.DumpSinks,
+			i.SinksDropped+i.SinkErrorsDropped,
+			i.SinkLoss())
+	}
+	return stats
+}
+
+// dopplerSkewStats renders each doppler's share of ingress and subscriptions and warns
+// about dopplers taking more than skewThreshold times the mean ingress
+func dopplerSkewStats(skew DopplerSkew) string {
+	if len(skew.Shares) == 0 {
+		return ""
+	}
+	stats := fmt.Sprintf("Doppler Skew (ingress cv=%.2f, subscriptions cv=%.2f)\n", skew.IngressCV, skew.SubscriptionCV)
+	stats += "Instance\t\t\t\t\tIngress-Share\tSubscription-Share\tx Mean\n"
+	stats += "------------------------------------------------------------------------------------------------------------------------------------\n"
+	for _, d := range skew.Shares {
+		row := fmt.Sprintf("%-40s\t%.1f%%\t\t%.1f%%\t\t\t%.2f", d.Name,
+			d.IngressShare*100,
+			d.SubscriptionShare*100,
+			d.IngressRatio)
+		if d.IngressRatio >= *skewThreshold {
+			row = tm.Color(row, tm.YELLOW)
+		}
+		stats += row + "\n"
+	}
+	for _, d := range skew.Hot(*skewThreshold) {
+		stats += tm.Color(fmt.Sprintf("WARNING: %s is taking %.1fx the mean doppler ingress", d.Name, d.IngressRatio), tm.YELLOW) + "\n"
+	}
+	return stats
+}
+
+// metronDropperStats renders the agents dropping the most envelopes
+func metronDropperStats(instances []MetronMetrics) string {
+	droppers, share := topMetronDroppers(instances, *topAgents)
+	if len(droppers) == 0 {
+		return fmt.Sprintf("Agent Drops: none of %d agents are dropping envelopes\n", len(instances))
+	}
+
+	stats := fmt.Sprintf("Top %d of %d Agents Dropping Envelopes (%.0f%% of all agent drops)\n", len(droppers), len(instances), share*100)
+	stats += "Deployment\t\t\tJob\t\t\tIndex\t\t\t\t\tIngress/s\tEgress/s\tDropped/s\tLoss\n"
+	stats += "------------------------------------------------------------------------------------------------------------------------------------\n"
+	for _, i := range droppers {
+		stats += fmt.Sprintf("%-24s\t%-16s\t%-36s\t%.0f\t\t%.0f\t\t%.0f\t\t%.2f\n", i.Deployment,
+			i.Job,
+			i.Index,
+			i.Ingress,
+			i.Egress,
+			i.Dropped,
+			float64(i.Dropped)/float64(i.Ingress))
+	}
+	return stats
+}
+
+// logCacheStats renders log cache node health.  Nodes expiring data before the
+// expected retention are red and nodes under memory pressure are yellow
+func logCacheStats(nodes []LogCacheMetrics) string {
+	stats := fmt.Sprintf("Log Cache Nodes (expected retention %s)\n", *lcRetention)
+	stats += "Node\t\t\t\t\tMemory-Used\tMemory-Total\tExpired/s\tCache-Period\tNozzle-Errors/s\n"
+	stats += "------------------------------------------------------------------------------------------------------------------------------------\n"
+	for _, n := range nodes {
+		row := fmt.Sprintf("%-40s\t%5.1f%%\t\t%s\t\t%.0f\t\t%s\t\t%.2f", n.Name,
+			n.MemoryPressure()*100,
+			formatBytes(n.TotalMemory),
+			n.Expired,
+			n.Period().Round(time.Second),
+			n.NozzleErrors)
+		switch {
+		case n.Evicting(*lcRetention):
+			row = tm.Color(row, tm.RED)
+		case n.MemoryPressure() > lcMemoryPressureWarn:
+			row = tm.Color(row, tm.YELLOW)
+		}
+		stats += row + "\n"
+	}
+	return stats
+}
+
+// appStats renders the applications writing the most envelopes.  The panel is left out
+// with -a 0
+func appStats(s *Snapshot) string {
+	if *topApps == 0 {
+		return ""
+	}
+	if s.NoAppRates {
+		return "Noisiest Apps: app rates are unavailable without log-cache meta\n"
+	}
+	if len(s.Metric.Apps) == 0 {
+		return "Noisiest Apps: sampling log-cache meta, rates are available after the next collection\n"
+	}
+	stats := fmt.Sprintf("Top %d Noisiest Apps\n", len(s.Metric.Apps))
+	stats += "App\t\t\t\t\t\t\tEnvelopes/s\tShare of Agent Ingress\n"
+	stats += "------------------------------------------------------------------------------------------------------------------------------------\n"
+	for _, a := range s.Metric.Apps {
+		stats += fmt.Sprintf("%-56s\t%.2f\t\t%5.1f%%\n", a.Name, a.Rate, a.Share*100)
+	}
+	return stats
+}
+
+// customStats renders catalog entries that are not part of the built in panels
+func customStats(custom []CustomMetric) string {
+	var stats, panel string
+	for _, c := range custom {
+		if c.Panel != panel {
+			panel = c.Panel
+			stats += fmt.Sprintf("\n%s:\n", panel)
+		}
+		label := c.Label
+		if label == "" {
+			label = c.Field
+		}
+		stats += fmt.Sprintf("%-32s: %.2f %s\n", label, c.Value, c.Unit)
+	}
+	return stats
+}
+
+func loopTerm(lcc snapshotSource) {
 	for {
 		time.Sleep(5 * time.Second)
 		updateTerm(lcc)
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	logcache "code.cloudfoundry.org/log-cache/pkg/client"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+var (
+	grpcAddr       *string
+	grpcCert       *string
+	grpcKey        *string
+	grpcCA         *string
+	grpcServerName *string
+	skipSSL        *bool
+	transportUsage = `
+--grpc <addr>  - talk gRPC to a log-cache node or gRPC endpoint (host:port)
+                 instead of the HTTP gateway
+--cert <file>  - client certificate for gRPC mutual TLS
+--key <file>   - client key for gRPC mutual TLS
+--ca <file>    - CA certificate used to verify log-cache, added to the system
+                 roots for the HTTP gateway
+--server-name <name> - expected log-cache certificate name, default is log-cache
+--skip-ssl-validation - do not verify the HTTP gateway certificate, also skipped
+                 when the api was targeted with cf api --skip-ssl-validation`
+)
+
+// addTransportFlags registers the log-cache transport flags on fs
+func addTransportFlags(fs *flag.FlagSet) {
+	grpcAddr = fs.String("grpc", "", "Specify log-cache gRPC address")
+	grpcCert = fs.String("cert", "", "Specify gRPC client certificate")
+	grpcKey = fs.String("key", "", "Specify gRPC client key")
+	grpcCA = fs.String("ca", "", "Specify gRPC CA certificate")
+	grpcServerName = fs.String("server-name", "log-cache", "Specify log-cache certificate name")
+	skipSSL = fs.Bool("skip-ssl-validation", false, "Specify to skip certificate verification")
+}
+
+// newLogCacheClient creates an LCC using the transport selected by flags
+func newLogCacheClient(concurrency int, cycleTimeout time.Duration) (*LCC, error) {
+	if *grpcAddr == "" {
+		tlsConfig, err := httpsTLSConfig(*grpcCA)
+		if err != nil {
+			return nil, err
+		}
+		return NewLogCacheClient(logCacheAddress(), tlsConfig, concurrency, cycleTimeout)
+	}
+	tlsConfig, err := grpcTLSConfig(*grpcCert, *grpcKey, *grpcCA, *grpcServerName)
+	if err != nil {
+		return nil, err
+	}
+	return NewLogCacheGRPCClient(*grpcAddr, tlsConfig, concurrency, cycleTimeout)
+}
+
+// grpcTLSConfig builds the mutual TLS config used to talk to log-cache nodes
+func grpcTLSConfig(certFile, keyFile, caFile, serverName string) (*tls.Config, error) {
+	if certFile == "" || keyFile == "" || caFile == "" {
+		return nil, fmt.Errorf("gRPC requires --cert, --key and --ca")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not load client certificate: %s", err)
+	}
+	pool := x509.NewCertPool()
+	if err := appendCA(pool, caFile); err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ServerName:   serverName,
+	}, nil
+}
+
+// httpsTLSConfig TLS config of the connections made with the user's token.  The server
+// certificate is verified against the system roots and caFile unless the user skips
+// ssl validation with --skip-ssl-validation or cf api --skip-ssl-validation
+func httpsTLSConfig(caFile string) (*tls.Config, error) {
+	skip := *skipSSL
+	if !skip {
+		disabled, err := cfCLI.IsSSLDisabled()
+		if err != nil {
+			return nil, err
+		}
+		skip = disabled
+	}
+	if skip || caFile == "" {
+		return &tls.Config{InsecureSkipVerify: skip}, nil
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if err := appendCA(pool, caFile); err != nil {
+		return nil, err
+	}
+	return &tls.Config{RootCAs: pool}, nil
+}
+
+// certificateHint explains how to trust a gateway whose certificate failed verification.
+// Other errors are returned unchanged
+func certificateHint(err error) error {
+	var authority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	if errors.As(err, &authority) || errors.As(err, &hostname) || errors.As(err, &invalid) {
+		return fmt.Errorf("%s, add the CA with --ca or skip verification with --skip-ssl-validation", err)
+	}
+	return err
+}
+
+// appendCA adds the certificates in caFile to pool
+func appendCA(pool *x509.CertPool, caFile string) error {
+	ca, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return fmt.Errorf("could not read CA certificate: %s", err)
+	}
+	if !pool.AppendCertsFromPEM(ca) {
+		return fmt.Errorf("no certificates found in %s", caFile)
+	}
+	return nil
+}
+
+// NewLogCacheGRPCClient creates a new LCC that talks gRPC to address using mutual TLS
+func NewLogCacheGRPCClient(address string, tlsConfig *tls.Config, concurrency int, cycleTimeout time.Duration) (lc *LCC, err error) {
+	lc = &LCC{Concurrency: concurrency, CycleTimeout: cycleTimeout, mutualTLS: true}
+
+	// the log-cache client panics when the dial fails
+	defer func() {
+		if r := recover(); r != nil {
+			lc, err = nil, fmt.Errorf("%v", r)
+		}
+	}()
+	lc.client = logcache.NewClient(address, logcache.WithViaGRPC(grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))))
+	return lc, nil
+}
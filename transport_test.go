@@ -0,0 +1,53 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCertificateHint(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	// the test server certificate is self-signed
+	c := &tokenHTTPClient{c: &http.Client{}, accessToken: "bearer abc"}
+	req, err := http.NewRequest("GET", srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Do(req); err == nil || !strings.Contains(err.Error(), "--ca") {
+		t.Errorf("expected the certificate error to name --ca got %v", err)
+	}
+
+	c = &tokenHTTPClient{c: srv.Client(), accessToken: "bearer abc"}
+	if _, err := c.Do(req); err != nil {
+		t.Errorf("expected the trusted certificate to be accepted got %v", err)
+	}
+	if err := certificateHint(nil); err != nil {
+		t.Errorf("expected no error got %v", err)
+	}
+}
+
+func TestGRPCClientNeedsNoToken(t *testing.T) {
+	// any call to the cf CLI would panic
+	c := cfCLI
+	cfCLI = nil
+	defer func() {
+		cfCLI = c
+		if r := recover(); r != nil {
+			t.Errorf("expected no token to be fetched over mutual TLS got %v", r)
+		}
+	}()
+	lc, err := NewLogCacheGRPCClient("127.0.0.1:1", &tls.Config{ServerName: "log-cache"}, 1, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lc.checkToken()
+	if lc.accessToken != "" {
+		t.Errorf("expected no access token got %q", lc.accessToken)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	logcache "code.cloudfoundry.org/log-cache/pkg/client"
+	"code.cloudfoundry.org/log-cache/pkg/rpc/logcache_v1"
+)
+
+// trendPoints number of points in each trend
+const trendPoints = 30
+
+var sparkTicks = []rune("▁▂▃▄▅▆▇█")
+
+// Trend values of a metric over the trend window, oldest first
+type Trend []float64
+
+// FlowTrends ingress, egress and drop trends of a component
+type FlowTrends struct {
+	Ingress Trend `json:"ingress"`
+	Egress  Trend `json:"egress"`
+	Dropped Trend `json:"dropped"`
+}
+
+// Trends history of the headline metrics
+type Trends struct {
+	Window     time.Duration `json:"window_ns"`
+	Doppler    FlowTrends    `json:"doppler"`
+	Metron     FlowTrends    `json:"metron"`
+	RLP        FlowTrends    `json:"rlp"`
+	TCCPU      Trend         `json:"tc_cpu"`
+	DopplerCPU Trend         `json:"doppler_cpu"`
+}
+
+// GetRangeResult runs a range query over the trend window ending now
+func (lc *LCC) GetRangeResult(ctx context.Context, window time.Duration, metric, sourceid, job, q string) (*logcache_v1.PromQL_RangeQueryResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	qformatted := formatQuery(metric, sourceid, job, q)
+
+	end := time.Now()
+	step := window / trendPoints
+	if step < time.Second {
+		step = time.Second
+	}
+	result, err := lc.client.PromQLRange(ctx, qformatted,
+		logcache.WithPromQLStart(end.Add(-window)),
+		logcache.WithPromQLEnd(end),
+		logcache.WithPromQLStep(fmt.Sprintf("%ds", int64(step.Seconds()))))
+	lc.queries.record(qformatted, true, end, err)
+	if err != nil {
+		return result, fmt.Errorf("%s: %s", qformatted, err)
+	}
+	return result, nil
+}
+
+// trend schedules a range query and stores the values of the first series in dst
+func (lc *LCC) trend(p *queryPool, dst *Trend, window time.Duration, metric, sourceid, job, q string) {
+	p.Go(formatQuery(metric, sourceid, job, q), func(ctx context.Context) error {
+		result, err := lc.GetRangeResult(ctx, window, metric, sourceid, job, q)
+		var t Trend
+		for _, s := range result.GetMatrix().GetSeries() {
+			for _, pt := range s.GetPoints() {
+				t = append(t, pt.GetValue())
+			}
+			break
+		}
+		p.Do(func() { *dst = t })
+		return err
+	})
+}
+
+// collectTrends schedules the range queries for every trend
+func (lc *LCC) collectTrends(p *queryPool, t *Trends, window time.Duration) {
+	t.Window = window
+	lc.trend(p, &t.Doppler.Ingress, window, ingressCounter, dopplerSID, dopplerJob, querySumRateJob)
+	lc.trend(p, &t.Doppler.Egress, window, egressCounter, dopplerSID, dopplerJob, querySumRateJob)
+	lc.trend(p, &t.Doppler.Dropped, window, droppedCounter, dopplerSID, dopplerJob, querySumRateJob)
+	lc.trend(p, &t.Metron.Ingress, window, ingressCounter, lc.Profile.AgentSID, "", querySumRate)
+	lc.trend(p, &t.Metron.Egress, window, egressCounter, lc.Profile.AgentSID, "", querySumRate)
+	lc.trend(p, &t.Metron.Dropped, window, droppedCounter, lc.Profile.AgentSID, "", querySumRate)
+	lc.trend(p, &t.RLP.Ingress, window, ingressCounter, rlpSID, tcJob, querySumRateJob)
+	lc.trend(p, &t.RLP.Egress, window, egressCounter, rlpSID, tcJob, querySumRateJob)
+	lc.trend(p, &t.RLP.Dropped, window, droppedCounter, rlpSID, tcJob, querySumRateJob)
+	lc.trend(p, &t.TCCPU, window, cpuUserGauge, boshSystemMetricsSID, tcJob, queryAvgOverTimeJob)
+	lc.trend(p, &t.DopplerCPU, window, cpuUserGauge, boshSystemMetricsSID, dopplerJob, queryAvgOverTimeJob)
+}
+
+// Sparkline renders the trend scaled between its own min and max
+func (t Trend) Sparkline() string {
+	if len(t) == 0 {
+		return "-"
+	}
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, v := range t {
+		min = math.Min(min, v)
+		max = math.Max(max, v)
+	}
+	line := make([]rune, 0, len(t))
+	for _, v := range t {
+		i := 0
+		if max > min {
+			i = int((v - min) / (max - min) * float64(len(sparkTicks)-1))
+		}
+		line = append(line, sparkTicks[i])
+	}
+	return string(line)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	logcache "code.cloudfoundry.org/log-cache/pkg/client"
+	"code.cloudfoundry.org/log-cache/pkg/rpc/logcache_v1"
+)
+
+// rangeReader answers range queries with the points stored for them and records the
+// step of every query
+type rangeReader struct {
+	blockingReader
+	points map[string][]float64
+	mux    sync.Mutex
+	steps  map[string]string
+}
+
+func (r *rangeReader) PromQLRange(ctx context.Context, query string, opts ...logcache.PromQLOption) (*logcache_v1.PromQL_RangeQueryResult, error) {
+	q := url.Values{}
+	for _, o := range opts {
+		o(&url.URL{}, q)
+	}
+	r.mux.Lock()
+	r.steps[query] = q.Get("step")
+	r.mux.Unlock()
+	values, ok := r.points[query]
+	if !ok {
+		return nil, fmt.Errorf("no result")
+	}
+	series := &logcache_v1.PromQL_Series{}
+	for _, v := range values {
+		series.Points = append(series.Points, &logcache_v1.PromQL_Point{Value: v})
+	}
+	// only the first series is used
+	other := &logcache_v1.PromQL_Series{Points: []*logcache_v1.PromQL_Point{{Value: -1}}}
+	return &logcache_v1.PromQL_RangeQueryResult{
+		Result: &logcache_v1.PromQL_RangeQueryResult_Matrix{Matrix: &logcache_v1.PromQL_Matrix{Series: []*logcache_v1.PromQL_Series{series, other}}},
+	}, nil
+}
+
+func TestSparkline(t *testing.T) {
+	tests := []struct {
+		name  string
+		trend Trend
+		want  string
+	}{
+		{name: "no points", want: "-"},
+		{name: "flat", trend: Trend{5, 5, 5}, want: "▁▁▁"},
+		{name: "rising", trend: Trend{0, 1, 2, 3, 4, 5, 6, 7}, want: "▁▂▃▄▅▆▇█"},
+		{name: "scaled to its own range", trend: Trend{100, 200, 150}, want: "▁█▄"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.trend.Sparkline(); got != tt.want {
+				t.Errorf("Sparkline() = %s, expected %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCollectTrends(t *testing.T) {
+	updateQeries("2m", "5m", "index")
+	ingress := formatQuery(ingressCounter, dopplerSID, dopplerJob, querySumRateJob)
+	tcCPU := formatQuery(cpuUserGauge, boshSystemMetricsSID, tcJob, queryAvgOverTimeJob)
+	reader := &rangeReader{
+		points: map[string][]float64{ingress: {100, 150, 120}, tcCPU: {20, 25}},
+		steps:  make(map[string]string),
+	}
+	lc := &LCC{client: reader, mutualTLS: true, Profile: queryProfiles["syslog-agent"]}
+	p := newQueryPool(context.Background(), 4)
+	var trends Trends
+	lc.collectTrends(p, &trends, time.Hour)
+	p.Wait()
+
+	if trends.Window != time.Hour {
+		t.Errorf("expected a 1h window got %s", trends.Window)
+	}
+	if !reflect.DeepEqual(trends.Doppler.Ingress, Trend{100, 150, 120}) || !reflect.DeepEqual(trends.TCCPU, Trend{20, 25}) {
+		t.Errorf("unexpected trends %v and %v", trends.Doppler.Ingress, trends.TCCPU)
+	}
+	if trends.Metron.Ingress != nil {
+		t.Errorf("expected a failed trend to be empty got %v", trends.Metron.Ingress)
+	}
+	// 9 of the 11 trends have no points
+	if errs := p.Errors(); len(errs) != 9 {
+		t.Errorf("expected 9 errors got %v", errs)
+	}
+	if step := reader.steps[ingress]; step != fmt.Sprintf("%ds", int64((time.Hour/trendPoints).Seconds())) {
+		t.Errorf("expected %d points over the window got step %s", trendPoints, step)
+	}
+
+	stats := trendStats(trends)
+	if !strings.Contains(stats, "Trends over the last 1h0m0s") || !strings.Contains(stats, "▁█▃") {
+		t.Errorf("unexpected trend panel %q", stats)
+	}
+	if trendStats(Trends{}) != "" {
+		t.Error("expected no trend panel without a window")
+	}
+}
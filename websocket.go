@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const wsMaxMessageSize = 16 * 1024 * 1024
+
+// websocket deadlines.  The traffic controller streams envelopes continuously and pings
+// idle connections so nothing arriving for wsReadTimeout means the firehose stalled
+var (
+	wsHandshakeTimeout = 30 * time.Second
+	wsReadTimeout      = time.Minute
+)
+
+// wsConn websocket used to read the firehose
+type wsConn struct {
+	conn        *websocket.Conn
+	readTimeout time.Duration
+}
+
+// dialWebsocket opens a websocket to rawurl (ws or wss) sending header with the upgrade.
+// Dialing and the handshake must finish within wsHandshakeTimeout
+func dialWebsocket(rawurl string, header http.Header, tlsConfig *tls.Config) (*wsConn, error) {
+	d := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		TLSClientConfig:  tlsConfig,
+		HandshakeTimeout: wsHandshakeTimeout,
+	}
+	conn, resp, err := d.Dial(rawurl, header)
+	if err == websocket.ErrBadHandshake && resp != nil {
+		return nil, fmt.Errorf("websocket handshake failed: %s", resp.Status)
+	}
+	if err != nil {
+		return nil, certificateHint(err)
+	}
+	c := &wsConn{conn: conn, readTimeout: wsReadTimeout}
+	conn.SetReadLimit(wsMaxMessageSize)
+	conn.SetPingHandler(func(data string) error {
+		// pings show the connection is alive while no envelopes arrive
+		conn.SetReadDeadline(time.Now().Add(c.readTimeout))
+		err := conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+		if err == websocket.ErrCloseSent {
+			return nil
+		}
+		return err
+	})
+	return c, nil
+}
+
+// ReadMessage returns the next text or binary message.  A close frame ends the stream
+// with io.EOF and nothing arriving within wsReadTimeout is an error
+func (c *wsConn) ReadMessage() ([]byte, error) {
+	c.conn.SetReadDeadline(time.Now().Add(c.readTimeout))
+	_, msg, err := c.conn.ReadMessage()
+	if _, ok := err.(*websocket.CloseError); ok {
+		return nil, io.EOF
+	}
+	if e, ok := err.(net.Error); ok && e.Timeout() {
+		return nil, fmt.Errorf("no message received for %s", c.readTimeout)
+	}
+	return msg, err
+}
+
+// Close sends a close frame and closes the underlying connection
+func (c *wsConn) Close() error {
+	c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	return c.conn.Close()
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsServer starts a websocket server that hands every upgraded connection to serve
+func wsServer(t *testing.T, serve func(c *websocket.Conn, r *http.Request)) string {
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer c.Close()
+		serve(c, r)
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+// drain reads until the client goes away so control frames are answered
+func drain(c *websocket.Conn) {
+	for {
+		if _, _, err := c.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// shortDeadlines lowers the websocket deadlines for the rest of the test
+func shortDeadlines(t *testing.T, d time.Duration) {
+	handshake, read := wsHandshakeTimeout, wsReadTimeout
+	wsHandshakeTimeout, wsReadTimeout = d, d
+	t.Cleanup(func() { wsHandshakeTimeout, wsReadTimeout = handshake, read })
+}
+
+func TestDialWebsocketHandshake(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	url := wsServer(t, func(c *websocket.Conn, r *http.Request) {
+		requests <- r
+		drain(c)
+	})
+	header := http.Header{}
+	header.Set("Authorization", "bearer abc")
+	ws, err := dialWebsocket(url+"/firehose/analyzer", header, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws.Close()
+	got := <-requests
+	if got.URL.Path != "/firehose/analyzer" || got.Header.Get("Authorization") != "bearer abc" {
+		t.Errorf("unexpected request %s with authorization %q", got.URL.Path, got.Header.Get("Authorization"))
+	}
+}
+
+func TestDialWebsocketRejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "missing doppler.firehose scope", http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+	_, err := dialWebsocket("ws"+strings.TrimPrefix(srv.URL, "http"), nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("expected the 401 to be reported got %v", err)
+	}
+	if _, err := dialWebsocket("http://localhost", nil, nil); err == nil {
+		t.Error("expected http scheme to be rejected")
+	}
+}
+
+func TestDialWebsocketTimeout(t *testing.T) {
+	shortDeadlines(t, 100*time.Millisecond)
+	// accepts connections but never answers the upgrade
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+
+	start := time.Now()
+	if _, err := dialWebsocket("ws://"+l.Addr().String(), nil, nil); err == nil {
+		t.Fatal("expected the silent handshake to time out")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the dial to give up after %s took %s", wsHandshakeTimeout, elapsed)
+	}
+}
+
+func TestWebsocketReadMessage(t *testing.T) {
+	large := bytes.Repeat([]byte("e"), 70000)
+	tests := []struct {
+		name     string
+		messages [][]byte
+	}{
+		{name: "single message", messages: [][]byte{[]byte("envelope")}},
+		{name: "several messages", messages: [][]byte{[]byte("one"), []byte("two"), []byte("three")}},
+		{name: "large message", messages: [][]byte{large}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := wsServer(t, func(c *websocket.Conn, r *http.Request) {
+				for _, m := range tt.messages {
+					c.WriteMessage(websocket.BinaryMessage, m)
+				}
+				c.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				drain(c)
+			})
+			ws, err := dialWebsocket(url, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ws.Close()
+			for _, want := range tt.messages {
+				got, err := ws.ReadMessage()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Errorf("expected %d bytes %.20q got %d bytes %.20q", len(want), want, len(got), got)
+				}
+			}
+			if _, err := ws.ReadMessage(); err != io.EOF {
+				t.Errorf("expected EOF after close got %v", err)
+			}
+		})
+	}
+}
+
+func TestWebsocketPing(t *testing.T) {
+	pongs := make(chan string, 1)
+	url := wsServer(t, func(c *websocket.Conn, r *http.Request) {
+		c.SetPongHandler(func(data string) error {
+			pongs <- data
+			return nil
+		})
+		c.WriteMessage(websocket.PingMessage, []byte("are you there"))
+		c.WriteMessage(websocket.BinaryMessage, []byte("envelope"))
+		drain(c)
+	})
+	ws, err := dialWebsocket(url, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	if msg, err := ws.ReadMessage(); err != nil || string(msg) != "envelope" {
+		t.Fatalf("expected the message after the ping got %q %v", msg, err)
+	}
+	select {
+	case data := <-pongs:
+		if data != "are you there" {
+			t.Errorf("expected the pong to echo the ping got %q", data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("expected the ping to be answered")
+	}
+}
+
+func TestWebsocketReadTimeout(t *testing.T) {
+	shortDeadlines(t, 100*time.Millisecond)
+	url := wsServer(t, func(c *websocket.Conn, r *http.Request) {
+		// stays silent until the client gives up
+		drain(c)
+	})
+	ws, err := dialWebsocket(url, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	start := time.Now()
+	if _, err := ws.ReadMessage(); err == nil || !strings.Contains(err.Error(), "no message received") {
+		t.Fatalf("expected a silent firehose to time out got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the read to give up after %s took %s", wsReadTimeout, elapsed)
+	}
+}
+
+func TestWebsocketOversizedMessage(t *testing.T) {
+	url := wsServer(t, func(c *websocket.Conn, r *http.Request) {
+		c.WriteMessage(websocket.BinaryMessage, make([]byte, wsMaxMessageSize+1))
+		drain(c)
+	})
+	ws, err := dialWebsocket(url, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	if _, err := ws.ReadMessage(); err != websocket.ErrReadLimit {
+		t.Errorf("expected the message to be rejected got %v", err)
+	}
+}